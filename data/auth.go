@@ -0,0 +1,81 @@
+package data
+
+import (
+	"context"
+	"crypto/subtle"
+
+	"encore.dev/beta/auth"
+	"encore.dev/beta/errs"
+)
+
+type Role string
+
+const (
+	// Organizers run the community and can use the admin endpoints
+	RoleOrganizer Role = "organizer"
+	// Services are other forge apps calling the data api, they can read and write people
+	RoleService Role = "service"
+)
+
+// AuthData is attached to authenticated requests
+type AuthData struct {
+	Role Role
+}
+
+// AuthHandler checks the bearer token on requests to auth endpoints
+//
+//encore:authhandler
+func AuthHandler(ctx context.Context, token string) (auth.UID, *AuthData, error) {
+	for _, key := range []struct {
+		role Role
+		key  string
+	}{
+		{RoleOrganizer, secrets.OrganizerAPIKey},
+		{RoleService, secrets.ServiceAPIKey},
+	} {
+		if key.key != "" && subtle.ConstantTimeCompare([]byte(token), []byte(key.key)) == 1 {
+			return auth.UID(key.role), &AuthData{Role: key.role}, nil
+		}
+	}
+	return "", nil, &errs.Error{
+		Code:    errs.Unauthenticated,
+		Message: "invalid token",
+	}
+}
+
+// RequireOrganizer fails unless the request was authenticated as an organizer, for every service's admin endpoints
+func RequireOrganizer() error {
+	d, ok := auth.Data().(*AuthData)
+	if !ok || d.Role != RoleOrganizer {
+		return &errs.Error{
+			Code:    errs.PermissionDenied,
+			Message: "only organizers can do this",
+		}
+	}
+	return nil
+}
+
+// requireRole fails unless the request was authenticated with one of the roles
+func requireRole(roles ...Role) error {
+	d, _ := auth.Data().(*AuthData)
+	return checkRole(d, roles...)
+}
+
+// checkRole is requireRole for the auth data of a request, d is nil for unauthenticated requests
+func checkRole(d *AuthData, roles ...Role) error {
+	if d == nil {
+		return &errs.Error{
+			Code:    errs.Unauthenticated,
+			Message: "this needs an api key",
+		}
+	}
+	for _, role := range roles {
+		if d.Role == role {
+			return nil
+		}
+	}
+	return &errs.Error{
+		Code:    errs.PermissionDenied,
+		Message: "your api key can't do this",
+	}
+}
@@ -0,0 +1,94 @@
+package data
+
+import (
+	"context"
+	"testing"
+
+	"encore.dev/beta/errs"
+)
+
+func useAPIKeys(t *testing.T, organizer string, service string) {
+	old := secrets
+	secrets.OrganizerAPIKey = organizer
+	secrets.ServiceAPIKey = service
+	t.Cleanup(func() { secrets = old })
+}
+
+func TestAuthHandlerRoles(t *testing.T) {
+	useAPIKeys(t, "organizer-key", "service-key")
+
+	for token, want := range map[string]Role{
+		"organizer-key": RoleOrganizer,
+		"service-key":   RoleService,
+	} {
+		uid, d, err := AuthHandler(context.Background(), token)
+		if err != nil || d.Role != want || string(uid) != string(want) {
+			t.Errorf("AuthHandler(%q) = %q %+v %v, expected %s", token, uid, d, err, want)
+		}
+	}
+
+	for _, token := range []string{"", "organizer-key ", "nope"} {
+		_, _, err := AuthHandler(context.Background(), token)
+		if e, ok := err.(*errs.Error); !ok || e.Code != errs.Unauthenticated {
+			t.Errorf("AuthHandler(%q) should be unauthenticated, got %#v", token, err)
+		}
+	}
+}
+
+func TestAuthHandlerIgnoresUnsetKeys(t *testing.T) {
+	useAPIKeys(t, "organizer-key", "")
+
+	_, _, err := AuthHandler(context.Background(), "")
+	if e, ok := err.(*errs.Error); !ok || e.Code != errs.Unauthenticated {
+		t.Errorf("an empty token matched the unset service key: %#v", err)
+	}
+}
+
+func TestCheckRole(t *testing.T) {
+	for _, tc := range []struct {
+		d    *AuthData
+		code errs.ErrCode
+	}{
+		{nil, errs.Unauthenticated},
+		{&AuthData{Role: RoleOrganizer}, errs.PermissionDenied},
+		{&AuthData{Role: RoleService}, errs.OK},
+	} {
+		err := checkRole(tc.d, RoleService)
+		if tc.code == errs.OK {
+			if err != nil {
+				t.Errorf("checkRole(%+v) = %#v, expected access", tc.d, err)
+			}
+			continue
+		}
+		if e, ok := err.(*errs.Error); !ok || e.Code != tc.code {
+			t.Errorf("checkRole(%+v) = %#v, expected %s", tc.d, err, tc.code)
+		}
+	}
+}
+
+func TestPersonViewByAccessLevel(t *testing.T) {
+	p := &Person{ID: 3}
+	p.Attributes.SlackID = "UC81JHDJ6"
+	p.Attributes.DisplayName = "soypete"
+	p.Attributes.GithubUser = "soypete"
+	p.Attributes.Email = "pete@example.com"
+	p.Attributes.MeetupID = "123"
+	p.Attributes.OnboardingStatus = OnboardingWelcomed
+
+	public := personView(nil, p)
+	if public.Attributes.Email != "" || public.Attributes.MeetupID != "" || public.Attributes.OnboardingStatus != "" {
+		t.Errorf("unauthenticated callers got private attributes: %+v", public.Attributes)
+	}
+	if public.Attributes.DisplayName != "soypete" || public.Attributes.GithubUser != "soypete" {
+		t.Errorf("unauthenticated callers should still see the public profile, got %+v", public.Attributes)
+	}
+	if p.Attributes.Email == "" {
+		t.Error("redacting changed the loaded person")
+	}
+
+	for _, role := range []Role{RoleService, RoleOrganizer} {
+		if got := personView(&AuthData{Role: role}, p); got != p {
+			t.Errorf("%s callers should get the whole person, got %+v", role, got.Attributes)
+		}
+	}
+}
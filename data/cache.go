@@ -0,0 +1,189 @@
+package data
+
+import (
+	"container/list"
+	"context"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// Lookups are cached this long, other instances' writes and missed webhooks show up after at most this
+	personCacheTTL = 2 * time.Minute
+	// The least recently used person is dropped past this many entries
+	personCacheSize = 2000
+)
+
+// personLookups caches person lookups in front of the mirror and the api
+var personLookups = newPersonCache(personCacheSize, personCacheTTL)
+
+// personCache is an LRU cache of person lookups with a TTL. Concurrent misses for a key share one load and
+// a load that raced an invalidation isn't cached. Lookups that fail, not found included, aren't cached.
+type personCache struct {
+	size int
+	ttl  time.Duration
+	now  func() time.Time
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	// order holds the entries, most recently used first
+	order    *list.List
+	inflight map[string]*personLoad
+	// epoch changes with every invalidation
+	epoch uint64
+	stats PersonCacheStats
+}
+
+type personCacheEntry struct {
+	key       string
+	person    *Person
+	expiresAt time.Time
+}
+
+// personLoad is a miss being loaded, the other lookups for the key wait on done
+type personLoad struct {
+	done   chan struct{}
+	person *Person
+	err    error
+}
+
+func newPersonCache(size int, ttl time.Duration) *personCache {
+	return &personCache{
+		size:     size,
+		ttl:      ttl,
+		now:      time.Now,
+		entries:  map[string]*list.Element{},
+		order:    list.New(),
+		inflight: map[string]*personLoad{},
+	}
+}
+
+// slackPersonKey is the cache key of a slack id lookup
+func slackPersonKey(tenant string, slackID string) string {
+	return "slack:" + tenant + "/" + slackID
+}
+
+// idPersonKey is the cache key of an id lookup
+func idPersonKey(id int) string {
+	return "id:" + strconv.Itoa(id)
+}
+
+// get returns the cached person for key or loads it. Callers get their own copy of the person.
+func (c *personCache) get(ctx context.Context, key string, load func(ctx context.Context) (*Person, error)) (*Person, error) {
+	c.mu.Lock()
+	if el, ok := c.entries[key]; ok {
+		entry := el.Value.(*personCacheEntry)
+		if c.now().Before(entry.expiresAt) {
+			c.order.MoveToFront(el)
+			c.stats.Hits++
+			c.mu.Unlock()
+			return copyPerson(entry.person), nil
+		}
+		c.remove(el)
+	}
+	c.stats.Misses++
+	if l, ok := c.inflight[key]; ok {
+		c.stats.Coalesced++
+		c.mu.Unlock()
+		select {
+		case <-l.done:
+			return copyPerson(l.person), l.err
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	l := &personLoad{done: make(chan struct{})}
+	c.inflight[key] = l
+	epoch := c.epoch
+	c.mu.Unlock()
+
+	l.person, l.err = load(ctx)
+
+	c.mu.Lock()
+	delete(c.inflight, key)
+	if l.err == nil && c.epoch == epoch {
+		c.set(key, l.person)
+	}
+	c.mu.Unlock()
+	close(l.done)
+	return copyPerson(l.person), l.err
+}
+
+// put caches a person that was just read fresh
+func (c *personCache) put(key string, p *Person) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.set(key, p)
+}
+
+// invalidate drops every lookup that returned the person and the lookup of their slack id
+func (c *personCache) invalidate(p *Person) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.epoch++
+	for _, el := range c.entries {
+		if el.Value.(*personCacheEntry).person.ID == p.ID {
+			c.remove(el)
+		}
+	}
+	if p.Attributes.SlackID != "" {
+		if el, ok := c.entries[slackPersonKey(p.Attributes.Tenant, p.Attributes.SlackID)]; ok {
+			c.remove(el)
+		}
+	}
+}
+
+// set stores a person, c.mu must be held
+func (c *personCache) set(key string, p *Person) {
+	if el, ok := c.entries[key]; ok {
+		c.remove(el)
+	}
+	c.entries[key] = c.order.PushFront(&personCacheEntry{key: key, person: copyPerson(p), expiresAt: c.now().Add(c.ttl)})
+	for c.order.Len() > c.size {
+		c.remove(c.order.Back())
+		c.stats.Evictions++
+	}
+}
+
+// remove drops an entry, c.mu must be held
+func (c *personCache) remove(el *list.Element) {
+	c.order.Remove(el)
+	delete(c.entries, el.Value.(*personCacheEntry).key)
+}
+
+// PersonCacheStats counts person cache lookups since the instance started
+type PersonCacheStats struct {
+	Hits   uint64
+	Misses uint64
+	// Coalesced are misses that waited on another lookup's load instead of loading themselves
+	Coalesced uint64
+	// Evictions are people dropped to make room, not expired or invalidated ones
+	Evictions uint64
+	Size      int
+}
+
+func (c *personCache) snapshot() *PersonCacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	stats := c.stats
+	stats.Size = c.order.Len()
+	return &stats
+}
+
+// PersonCacheMetrics shows organizers how well this instance's person cache is doing
+// encore:api auth method=GET path=/data/cache/people
+func PersonCacheMetrics(ctx context.Context) (*PersonCacheStats, error) {
+	if err := RequireOrganizer(); err != nil {
+		return nil, err
+	}
+	return personLookups.snapshot(), nil
+}
+
+func copyPerson(p *Person) *Person {
+	if p == nil {
+		return nil
+	}
+	cp := *p
+	return &cp
+}
@@ -0,0 +1,140 @@
+package data
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"encore.dev/beta/errs"
+)
+
+func cachedPerson(id int, slackID string) *Person {
+	p := &Person{ID: id}
+	p.Attributes.SlackID = slackID
+	return p
+}
+
+// countingLoad loads p and counts how often it was called
+func countingLoad(p *Person, calls *int) func(ctx context.Context) (*Person, error) {
+	return func(ctx context.Context) (*Person, error) {
+		*calls++
+		return p, nil
+	}
+}
+
+func TestPersonCacheExpiresAndEvicts(t *testing.T) {
+	now := time.Date(2023, 3, 1, 12, 0, 0, 0, time.UTC)
+	c := newPersonCache(2, time.Minute)
+	c.now = func() time.Time { return now }
+	ctx := context.Background()
+	calls := 0
+
+	c.get(ctx, "a", countingLoad(cachedPerson(1, "U1"), &calls))
+	c.get(ctx, "a", countingLoad(cachedPerson(1, "U1"), &calls))
+	if calls != 1 {
+		t.Fatalf("expected the second lookup to be a hit, loaded %d times", calls)
+	}
+
+	now = now.Add(time.Minute)
+	c.get(ctx, "a", countingLoad(cachedPerson(1, "U1"), &calls))
+	if calls != 2 {
+		t.Errorf("expected an expired lookup to load again, loaded %d times", calls)
+	}
+
+	// b and c push out a, the least recently used
+	c.get(ctx, "b", countingLoad(cachedPerson(2, "U2"), &calls))
+	c.get(ctx, "c", countingLoad(cachedPerson(3, "U3"), &calls))
+	if _, ok := c.entries["a"]; ok {
+		t.Error("expected a to be evicted")
+	}
+	stats := c.snapshot()
+	if stats.Hits != 1 || stats.Misses != 4 || stats.Evictions != 1 || stats.Size != 2 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+}
+
+func TestPersonCacheDoesntCacheErrors(t *testing.T) {
+	c := newPersonCache(10, time.Minute)
+	notFound := &errs.Error{Code: errs.NotFound}
+	for i := 0; i < 2; i++ {
+		_, err := c.get(context.Background(), "a", func(ctx context.Context) (*Person, error) { return nil, notFound })
+		if err != notFound {
+			t.Fatalf("expected the load's error, got %v", err)
+		}
+	}
+	if c.snapshot().Misses != 2 {
+		t.Errorf("expected both lookups to miss, got %+v", c.snapshot())
+	}
+}
+
+func TestPersonCacheCoalescesMisses(t *testing.T) {
+	c := newPersonCache(10, time.Minute)
+	release := make(chan struct{})
+	loading := make(chan struct{})
+	calls := 0
+	load := func(ctx context.Context) (*Person, error) {
+		calls++
+		close(loading)
+		<-release
+		return cachedPerson(1, "U1"), nil
+	}
+
+	var wg sync.WaitGroup
+	results := make([]*Person, 3)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		results[0], _ = c.get(context.Background(), "a", load)
+	}()
+	<-loading
+	for i := 1; i < 3; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i], _ = c.get(context.Background(), "a", load)
+		}(i)
+	}
+	// Wait for the other lookups to join the load before letting it finish
+	for c.snapshot().Coalesced < 2 {
+		time.Sleep(time.Millisecond)
+	}
+	close(release)
+	wg.Wait()
+
+	if calls != 1 {
+		t.Errorf("expected one load, got %d", calls)
+	}
+	for i, p := range results {
+		if p == nil || p.ID != 1 {
+			t.Errorf("lookup %d got %+v", i, p)
+		}
+	}
+	if results[0] == results[1] {
+		t.Error("expected every caller to get their own copy")
+	}
+}
+
+func TestPersonCacheInvalidation(t *testing.T) {
+	c := newPersonCache(10, time.Minute)
+	ctx := context.Background()
+	calls := 0
+	p := cachedPerson(1, "U1")
+	c.get(ctx, slackPersonKey("", "U1"), countingLoad(p, &calls))
+	c.get(ctx, idPersonKey(1), countingLoad(p, &calls))
+	c.get(ctx, idPersonKey(2), countingLoad(cachedPerson(2, "U2"), &calls))
+
+	c.invalidate(p)
+	if len(c.entries) != 1 || c.entries[idPersonKey(2)] == nil {
+		t.Errorf("expected only person 2 to stay cached, got %d entries", len(c.entries))
+	}
+
+	// A load that started before an invalidation may have read the old person
+	c.get(ctx, idPersonKey(1), func(ctx context.Context) (*Person, error) {
+		c.invalidate(p)
+		return p, nil
+	})
+	if _, ok := c.entries[idPersonKey(1)]; ok {
+		t.Error("expected a load that raced an invalidation not to be cached")
+	}
+}
@@ -2,10 +2,16 @@ package data
 
 import (
 	"bytes"
-	"fmt"
+	"context"
+	"encoding/json"
 	"io/ioutil"
+	"math/rand"
 	"net/http"
+	"strconv"
+	"sync"
+	"time"
 
+	"encore.dev/beta/errs"
 	"encore.dev/rlog"
 )
 
@@ -14,43 +20,328 @@ const BaseURL = "https://forge-api.fly.dev/api/"
 var secrets struct {
 	ForgeDataAPIToken string
 	KollaAPIKey       string
+	OrganizerAPIKey   string
+	// ServiceAPIKey is used by other forge apps, like the website, that need full person records
+	ServiceAPIKey string
+	// DataAPIWebhookToken is sent by the Forge Data API's webhooks as a bearer token
+	DataAPIWebhookToken string
 }
 
-func HttpRequest(method string, path string, body []byte) ([]byte, *http.Response, error) {
-	respBody := []byte{}
-	resp := &http.Response{}
+const (
+	// Each attempt gets this long, a slow fly.dev instance shouldn't hang slack handlers
+	dataRequestTimeout = 10 * time.Second
+	// Idempotent requests are tried this many times on network errors and 5xx responses, any request on a 429
+	dataRequestAttempts = 3
+	// The wait before the first retry, it doubles for each retry after that
+	dataRetryBaseDelay = 200 * time.Millisecond
+	// A throttled request is retried after the Retry-After the api asks for, unless that is longer than this
+	dataMaxRetryAfter = 5 * time.Second
+	// The breaker opens after this many failures in a row and lets a request through again after the cooldown
+	breakerThreshold = 5
+	breakerCooldown  = 30 * time.Second
+)
+
+// idempotentMethods are safe to send again when we don't know whether the first attempt went through
+var idempotentMethods = map[string]bool{
+	http.MethodGet:    true,
+	http.MethodHead:   true,
+	http.MethodPut:    true,
+	http.MethodDelete: true,
+}
 
+// dataAPI is the client every Forge Data API request goes through
+var dataAPI = newDataClient(BaseURL, func() string { return secrets.ForgeDataAPIToken })
+
+func HttpRequest(ctx context.Context, method string, path string, body []byte) ([]byte, *http.Response, error) {
 	rlog.Debug("Data API Request", "method", method, "url", BaseURL+path, "body", string(body))
 
-	r := bytes.NewReader(body)
-	req, err := http.NewRequest(method, BaseURL+path, r)
+	respBody, resp, err := dataAPI.request(ctx, method, path, body)
 	if err != nil {
-		rlog.Error("Error creating api request", "err", err)
+		// The upstream body stays in our logs, callers only see the mapped error
+		rlog.Error("Error response from forge data api", "method", method, "path", path, "err", err, "body", string(respBody))
 		return respBody, resp, err
 	}
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+secrets.ForgeDataAPIToken)
+	rlog.Debug("Data API Response", "body", string(respBody))
+	return respBody, resp, nil
+}
 
-	client := &http.Client{}
-	resp, err = client.Do(req)
+// dataClient sends requests to the Forge Data API. Idempotent requests are retried with jittered backoff, throttled
+// ones after the api's Retry-After, and a circuit breaker fails requests fast while the api is down.
+type dataClient struct {
+	baseURL string
+	token   func() string
+	client  *http.Client
+	breaker *circuitBreaker
+	// sleep waits between retries
+	sleep func(ctx context.Context, d time.Duration) error
+}
 
+func newDataClient(baseURL string, token func() string) *dataClient {
+	return &dataClient{
+		baseURL: baseURL,
+		token:   token,
+		client:  &http.Client{},
+		breaker: newCircuitBreaker(),
+		sleep:   sleepContext,
+	}
+}
+
+func (c *dataClient) request(ctx context.Context, method string, path string, body []byte) ([]byte, *http.Response, error) {
+	for attempt := 1; ; attempt++ {
+		if err := c.breaker.allow(); err != nil {
+			return nil, nil, err
+		}
+		respBody, resp, err := c.send(ctx, method, path, body)
+		// The caller giving up says nothing about the api
+		if ctx.Err() != nil {
+			c.breaker.abandon()
+			return respBody, resp, err
+		}
+		failed := err != nil && (resp == nil || resp.StatusCode >= 500)
+		throttled := resp != nil && resp.StatusCode == http.StatusTooManyRequests
+		c.breaker.record(!failed)
+		// A throttled request wasn't processed, so it is safe to send again whatever the method
+		retryable := throttled || (failed && idempotentMethods[method])
+		if !retryable || attempt == dataRequestAttempts {
+			return respBody, resp, err
+		}
+		delay := retryDelay(attempt)
+		if throttled {
+			wait, ok := retryAfter(resp.Header.Get("Retry-After"), time.Now())
+			if ok && wait > dataMaxRetryAfter {
+				return respBody, resp, err
+			}
+			if ok {
+				delay = wait
+			}
+		}
+		if err := c.sleep(ctx, delay); err != nil {
+			return respBody, resp, err
+		}
+	}
+}
+
+// send makes one attempt within its own deadline
+func (c *dataClient) send(ctx context.Context, method string, path string, body []byte) ([]byte, *http.Response, error) {
+	ctx, cancel := context.WithTimeout(ctx, dataRequestTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, bytes.NewReader(body))
 	if err != nil {
-		rlog.Error("Error sending request forge data api", "err", err)
-		return respBody, resp, err
+		return nil, nil, err
 	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+c.token())
 
-	// Get response body and parse to json
-	respBody, err = ioutil.ReadAll(resp.Body)
+	resp, err := c.client.Do(req)
 	if err != nil {
-		rlog.Error("Error reading data api response", "err", err)
-		return respBody, resp, err
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return respBody, nil, err
 	}
-	rlog.Debug("Data API Response", "body", string(respBody))
-	// Check for error code
 	if resp.StatusCode != http.StatusOK {
-		rlog.Error("Error response from forge data api", "status", resp.StatusCode, "body", string(respBody))
-		return respBody, resp, fmt.Errorf("Error response from forge data api: %s", string(respBody))
+		return respBody, resp, dataAPIError(resp.StatusCode, respBody)
 	}
-
 	return respBody, resp, nil
 }
+
+// strapiErrorResponse is the envelope strapi wraps errors in
+type strapiErrorResponse struct {
+	Error struct {
+		Status  int    `json:"status"`
+		Name    string `json:"name"`
+		Message string `json:"message"`
+		Details struct {
+			Errors []DataAPIFieldError `json:"errors"`
+		} `json:"details"`
+	} `json:"error"`
+}
+
+// DataAPIErrorDetails are attached to errors returned by the Forge Data API
+type DataAPIErrorDetails struct {
+	// Status is the http status the api responded with
+	Status int
+	// Name is strapi's error name, e.g. ValidationError or NotFoundError
+	Name string `json:",omitempty"`
+	// Errors are the fields a request failed validation on
+	Errors []DataAPIFieldError `json:",omitempty"`
+}
+
+func (*DataAPIErrorDetails) ErrDetails() {}
+
+type DataAPIFieldError struct {
+	Path    []string `json:"path"`
+	Message string   `json:"message"`
+}
+
+// dataAPIErrorCodes maps api response statuses to error codes, other 4xx statuses are internal errors and
+// 5xx statuses are unavailable
+var dataAPIErrorCodes = map[int]errs.ErrCode{
+	http.StatusBadRequest:      errs.InvalidArgument,
+	http.StatusUnauthorized:    errs.Unauthenticated,
+	http.StatusForbidden:       errs.PermissionDenied,
+	http.StatusNotFound:        errs.NotFound,
+	http.StatusTooManyRequests: errs.ResourceExhausted,
+}
+
+// dataAPIError maps an error response to an errs.Error. Strapi's own message is only passed on for client
+// errors, a server error's body can hold anything.
+func dataAPIError(status int, body []byte) *errs.Error {
+	envelope := &strapiErrorResponse{}
+	// Proxies in front of the api don't answer with strapi's envelope, the status is enough then
+	_ = json.Unmarshal(body, envelope)
+
+	details := &DataAPIErrorDetails{Status: status}
+	if status >= 500 {
+		return &errs.Error{
+			Code:    errs.Unavailable,
+			Message: "the forge data api is unavailable, try again shortly",
+			Details: details,
+		}
+	}
+
+	code, ok := dataAPIErrorCodes[status]
+	if !ok {
+		code = errs.Internal
+	}
+	details.Name = envelope.Error.Name
+	details.Errors = envelope.Error.Details.Errors
+	message := envelope.Error.Message
+	if message == "" {
+		message = http.StatusText(status)
+	}
+	return &errs.Error{
+		Code:    code,
+		Message: "forge data api: " + message,
+		Details: details,
+	}
+}
+
+// retryDelay doubles the wait for every retry and picks a random point in its upper half,
+// so instances that failed together don't retry together
+func retryDelay(attempt int) time.Duration {
+	delay := dataRetryBaseDelay << (attempt - 1)
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)))
+}
+
+// retryAfter parses a Retry-After header, either seconds or an http date
+func retryAfter(header string, now time.Time) (time.Duration, bool) {
+	if header == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(header); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if at, err := http.ParseTime(header); err == nil {
+		if wait := at.Sub(now); wait > 0 {
+			return wait, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Circuit breaker states
+const (
+	breakerClosed   = "closed"
+	breakerOpen     = "open"
+	breakerHalfOpen = "half-open"
+)
+
+// circuitBreaker stops sending requests after breakerThreshold failures in a row. Once the cooldown has passed a
+// single request is let through, if it succeeds the breaker closes again.
+type circuitBreaker struct {
+	now func() time.Time
+
+	mu       sync.Mutex
+	state    string
+	failures int
+	openedAt time.Time
+	// probing is set while the half-open request is in flight
+	probing bool
+}
+
+func newCircuitBreaker() *circuitBreaker {
+	return &circuitBreaker{now: time.Now, state: breakerClosed}
+}
+
+// allow fails with errs.Unavailable while the breaker is open
+func (b *circuitBreaker) allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == breakerOpen && b.now().Sub(b.openedAt) >= breakerCooldown {
+		b.state = breakerHalfOpen
+		b.probing = false
+	}
+	if b.state == breakerClosed || (b.state == breakerHalfOpen && !b.probing) {
+		b.probing = b.state == breakerHalfOpen
+		return nil
+	}
+	return &errs.Error{
+		Code:    errs.Unavailable,
+		Message: "the forge data api is unavailable, try again shortly",
+	}
+}
+
+// record counts the outcome of a request the breaker allowed
+func (b *circuitBreaker) record(success bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+	if success {
+		b.state = breakerClosed
+		b.failures = 0
+		return
+	}
+	b.failures++
+	if b.state == breakerHalfOpen || b.failures >= breakerThreshold {
+		b.state = breakerOpen
+		b.openedAt = b.now()
+	}
+}
+
+// abandon lets another request probe the api when an allowed request was cancelled
+func (b *circuitBreaker) abandon() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+}
+
+type DataAPIHealthResponse struct {
+	// State is closed while the api is healthy, open while requests fail fast and half-open while one is let
+	// through to check on it
+	State               string
+	ConsecutiveFailures int
+	// OpenedAt is when the breaker last opened, RFC 3339
+	OpenedAt string `json:",omitempty"`
+}
+
+func (b *circuitBreaker) health() *DataAPIHealthResponse {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	ret := &DataAPIHealthResponse{State: b.state, ConsecutiveFailures: b.failures}
+	if !b.openedAt.IsZero() {
+		ret.OpenedAt = b.openedAt.UTC().Format(time.RFC3339)
+	}
+	return ret
+}
+
+// DataAPIHealth reports whether the service can reach the Forge Data API
+// encore:api public path=/data/health
+func DataAPIHealth(ctx context.Context) (*DataAPIHealthResponse, error) {
+	return dataAPI.breaker.health(), nil
+}
@@ -0,0 +1,171 @@
+package data
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"encore.dev/beta/errs"
+)
+
+// testDataClient talks to a server answering with the given statuses in turn, the last one repeats
+func testDataClient(t *testing.T, statuses ...int) (*dataClient, *int32) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := int(atomic.AddInt32(&calls, 1))
+		if n > len(statuses) {
+			n = len(statuses)
+		}
+		if statuses[n-1] == http.StatusTooManyRequests {
+			w.Header().Set("Retry-After", "2")
+		}
+		w.WriteHeader(statuses[n-1])
+		w.Write([]byte(`{"data":null}`))
+	}))
+	t.Cleanup(server.Close)
+
+	c := newDataClient(server.URL+"/", func() string { return "token" })
+	c.sleep = func(ctx context.Context, d time.Duration) error { return nil }
+	return c, &calls
+}
+
+func TestDataClientRetriesIdempotentRequests(t *testing.T) {
+	c, calls := testDataClient(t, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusOK)
+
+	_, _, err := c.request(context.Background(), "GET", "people", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *calls != 3 {
+		t.Errorf("expected 3 attempts, got %d", *calls)
+	}
+}
+
+func TestDataClientDoesntRetryCreatesOrClientErrors(t *testing.T) {
+	c, calls := testDataClient(t, http.StatusInternalServerError)
+	if _, _, err := c.request(context.Background(), "POST", "people", []byte(`{}`)); err == nil {
+		t.Fatal("expected the 500 to be returned")
+	}
+	if *calls != 1 {
+		t.Errorf("a POST was sent %d times", *calls)
+	}
+
+	c, calls = testDataClient(t, http.StatusNotFound)
+	if _, _, err := c.request(context.Background(), "GET", "people/1", nil); err == nil {
+		t.Fatal("expected the 404 to be returned")
+	}
+	if *calls != 1 || c.breaker.health().ConsecutiveFailures != 0 {
+		t.Errorf("a 404 was retried or counted against the api: %d calls, %+v", *calls, c.breaker.health())
+	}
+}
+
+func TestCircuitBreakerFailsFastWhileOpen(t *testing.T) {
+	c, calls := testDataClient(t, http.StatusServiceUnavailable)
+	now := time.Date(2023, 3, 1, 12, 0, 0, 0, time.UTC)
+	c.breaker.now = func() time.Time { return now }
+
+	// Two requests of three attempts each trip the breaker
+	c.request(context.Background(), "GET", "people", nil)
+	c.request(context.Background(), "GET", "people", nil)
+	if h := c.breaker.health(); h.State != breakerOpen {
+		t.Fatalf("expected the breaker to be open, got %+v", h)
+	}
+	sent := *calls
+
+	_, _, err := c.request(context.Background(), "GET", "people", nil)
+	if e, ok := err.(*errs.Error); !ok || e.Code != errs.Unavailable {
+		t.Errorf("expected an open breaker to fail with Unavailable, got %#v", err)
+	}
+	if *calls != sent {
+		t.Errorf("an open breaker still sent %d requests", *calls-sent)
+	}
+
+	// After the cooldown one request checks on the api, it is still down so the breaker opens again
+	now = now.Add(breakerCooldown)
+	c.request(context.Background(), "GET", "people", nil)
+	if *calls != sent+1 || c.breaker.health().State != breakerOpen {
+		t.Errorf("expected a single probe that reopened the breaker, got %d requests and %+v", *calls-sent, c.breaker.health())
+	}
+}
+
+func TestCircuitBreakerClosesAfterProbe(t *testing.T) {
+	now := time.Date(2023, 3, 1, 12, 0, 0, 0, time.UTC)
+	b := newCircuitBreaker()
+	b.now = func() time.Time { return now }
+	for i := 0; i < breakerThreshold; i++ {
+		b.allow()
+		b.record(false)
+	}
+
+	now = now.Add(breakerCooldown)
+	if err := b.allow(); err != nil {
+		t.Fatalf("expected a probe after the cooldown, got %v", err)
+	}
+	if err := b.allow(); err == nil {
+		t.Fatal("only one request should probe at a time")
+	}
+	b.record(true)
+	if h := b.health(); h.State != breakerClosed || h.ConsecutiveFailures != 0 {
+		t.Errorf("expected a successful probe to close the breaker, got %+v", h)
+	}
+}
+
+func TestDataAPIErrorMapsStrapiErrors(t *testing.T) {
+	body := []byte(`{"data":null,"error":{"status":400,"name":"ValidationError","message":"1 error occurred",` +
+		`"details":{"errors":[{"path":["email"],"message":"email must be a valid email","name":"ValidationError"}]}}}`)
+	err := dataAPIError(http.StatusBadRequest, body)
+	if err.Code != errs.InvalidArgument || err.Message != "forge data api: 1 error occurred" {
+		t.Errorf("unexpected error %+v", err)
+	}
+	details := err.Details.(*DataAPIErrorDetails)
+	if details.Name != "ValidationError" || len(details.Errors) != 1 || details.Errors[0].Path[0] != "email" {
+		t.Errorf("unexpected details %+v", details)
+	}
+
+	for status, code := range map[int]errs.ErrCode{
+		http.StatusUnauthorized:    errs.Unauthenticated,
+		http.StatusForbidden:       errs.PermissionDenied,
+		http.StatusNotFound:        errs.NotFound,
+		http.StatusConflict:        errs.Internal,
+		http.StatusBadGateway:      errs.Unavailable,
+		http.StatusTooManyRequests: errs.ResourceExhausted,
+	} {
+		if err := dataAPIError(status, []byte("<html>gateway</html>")); err.Code != code {
+			t.Errorf("expected %d to map to %s, got %s", status, code, err.Code)
+		}
+	}
+}
+
+func TestDataAPIErrorHidesServerErrorBodies(t *testing.T) {
+	body := []byte(`{"error":{"status":500,"name":"InternalServerError","message":"select * from people failed"}}`)
+	err := dataAPIError(http.StatusInternalServerError, body)
+	if err.Code != errs.Unavailable || strings.Contains(err.Message, "select") {
+		t.Errorf("unexpected error %+v", err)
+	}
+	if details := err.Details.(*DataAPIErrorDetails); details.Name != "" || details.Status != 500 {
+		t.Errorf("unexpected details %+v", details)
+	}
+}
+
+func TestDataClientRetriesThrottledRequestsAfterRetryAfter(t *testing.T) {
+	c, calls := testDataClient(t, http.StatusTooManyRequests, http.StatusOK)
+	var waited time.Duration
+	c.sleep = func(ctx context.Context, d time.Duration) error {
+		waited += d
+		return nil
+	}
+
+	if _, _, err := c.request(context.Background(), "POST", "people", []byte(`{}`)); err != nil {
+		t.Fatal(err)
+	}
+	if *calls != 2 || waited != 2*time.Second {
+		t.Errorf("expected one retry after the 2s Retry-After, got %d calls after waiting %s", *calls, waited)
+	}
+	if h := c.breaker.health(); h.ConsecutiveFailures != 0 {
+		t.Errorf("a 429 counted against the api: %+v", h)
+	}
+}
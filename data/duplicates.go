@@ -0,0 +1,380 @@
+package data
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"encore.dev/beta/auth"
+	"encore.dev/beta/errs"
+	"encore.dev/rlog"
+)
+
+// The person attributes besides the identifiers that duplicate detection and merges work with
+const (
+	AttributeDisplayName   = "display_name"
+	AttributeBio           = "bio"
+	AttributeTwitterHandle = "twitter_handle"
+	AttributeLinkedinURL   = "linkedin_url"
+)
+
+// Pairs scoring at least this much are reported as likely duplicates
+const duplicateThreshold = 0.5
+
+// duplicateWeights is how much a shared identifier says two people are the same human. Emails and meetup ids
+// are personal, github and linkedin accounts nearly so, and names only tip the balance.
+var duplicateWeights = map[string]float64{
+	IdentifierEmail:      0.6,
+	IdentifierMeetupID:   0.6,
+	IdentifierGithubUser: 0.4,
+	AttributeLinkedinURL: 0.4,
+	AttributeDisplayName: 0.2,
+}
+
+// DuplicatePair is two people that are probably the same human
+type DuplicatePair struct {
+	// A is the older record, the one a merge should usually keep
+	A     int
+	B     int
+	Score float64
+	// Matches are the attributes the two share
+	Matches []string
+}
+
+type DuplicateReport struct {
+	Pairs []DuplicatePair
+}
+
+// detectDuplicatePeople scores every pair of people sharing an identifier
+func detectDuplicatePeople(ctx context.Context) (*DuplicateReport, error) {
+	all, err := people.FindAll(ctx, NewQuery().Sort("id:asc"))
+	if err != nil {
+		return nil, err
+	}
+	report := &DuplicateReport{Pairs: findDuplicates(all)}
+	rlog.Info("Duplicate detection finished", "people", len(all), "pairs", len(report.Pairs))
+	return report, nil
+}
+
+// ListDuplicatePeople shows organizers the people that are probably the same human
+// encore:api auth method=GET path=/data/duplicates
+func ListDuplicatePeople(ctx context.Context) (*DuplicateReport, error) {
+	if err := RequireOrganizer(); err != nil {
+		return nil, err
+	}
+	return detectDuplicatePeople(ctx)
+}
+
+// duplicateKey normalizes an attribute so trivially different spellings still match
+func duplicateKey(attribute string, value string) string {
+	value = strings.ToLower(strings.TrimSpace(value))
+	switch attribute {
+	case AttributeDisplayName:
+		value = strings.Join(strings.Fields(value), " ")
+	case AttributeLinkedinURL:
+		value = strings.TrimSuffix(value, "/")
+	}
+	return value
+}
+
+// findDuplicates pairs up people that share an attribute and keeps the pairs scoring over the threshold.
+// People are only compared within the buckets of a shared value so this stays fast for the whole community.
+func findDuplicates(all []*Person) []DuplicatePair {
+	type pairKey struct{ a, b int }
+	matches := map[pairKey][]string{}
+
+	for attribute := range duplicateWeights {
+		buckets := map[string][]*Person{}
+		for _, p := range all {
+			value := duplicateKey(attribute, attributeValue(p, attribute))
+			if value == "" {
+				continue
+			}
+			buckets[value] = append(buckets[value], p)
+		}
+		for _, bucket := range buckets {
+			for i := 0; i < len(bucket); i++ {
+				for j := i + 1; j < len(bucket); j++ {
+					a, b := bucket[i].ID, bucket[j].ID
+					if a > b {
+						a, b = b, a
+					}
+					key := pairKey{a, b}
+					matches[key] = append(matches[key], attribute)
+				}
+			}
+		}
+	}
+
+	pairs := []DuplicatePair{}
+	for key, attributes := range matches {
+		score := 0.0
+		for _, attribute := range attributes {
+			score += duplicateWeights[attribute]
+		}
+		if score > 1 {
+			score = 1
+		}
+		if score < duplicateThreshold {
+			continue
+		}
+		sort.Strings(attributes)
+		pairs = append(pairs, DuplicatePair{A: key.a, B: key.b, Score: score, Matches: attributes})
+	}
+	sort.Slice(pairs, func(i, j int) bool {
+		if pairs[i].Score != pairs[j].Score {
+			return pairs[i].Score > pairs[j].Score
+		}
+		if pairs[i].A != pairs[j].A {
+			return pairs[i].A < pairs[j].A
+		}
+		return pairs[i].B < pairs[j].B
+	})
+	return pairs
+}
+
+// mergeableAttributes are the person attributes a merge picks between the two records
+var mergeableAttributes = []string{
+	AttributeDisplayName, AttributeBio, IdentifierGithubUser, AttributeTwitterHandle, IdentifierSlackID,
+	IdentifierMeetupID, IdentifierEmail, AttributeLinkedinURL,
+}
+
+// attributeValue reads a mergeable attribute off a person
+func attributeValue(p *Person, attribute string) string {
+	switch attribute {
+	case AttributeDisplayName:
+		return p.Attributes.DisplayName
+	case AttributeBio:
+		return p.Attributes.Bio
+	case IdentifierGithubUser:
+		return p.Attributes.GithubUser
+	case AttributeTwitterHandle:
+		return p.Attributes.TwitterHandle
+	case IdentifierSlackID:
+		return p.Attributes.SlackID
+	case IdentifierMeetupID:
+		return p.Attributes.MeetupID
+	case IdentifierEmail:
+		return p.Attributes.Email
+	case AttributeLinkedinURL:
+		return p.Attributes.LinkedinURL
+	}
+	return ""
+}
+
+// setAttribute sets a mergeable attribute on an update
+func setAttribute(u *PersonUpdate, attribute string, value string) {
+	switch attribute {
+	case AttributeDisplayName:
+		u.DisplayName = &value
+	case AttributeBio:
+		u.Bio = &value
+	case IdentifierGithubUser:
+		u.GithubUser = &value
+	case AttributeTwitterHandle:
+		u.TwitterHandle = &value
+	case IdentifierSlackID:
+		u.SlackID = &value
+	case IdentifierMeetupID:
+		u.MeetupID = &value
+	case IdentifierEmail:
+		u.Email = &value
+	case AttributeLinkedinURL:
+		u.LinkedinURL = &value
+	}
+}
+
+// Which record a merged attribute is taken from
+const (
+	MergeKeepSurvivor  = "survivor"
+	MergeKeepDuplicate = "duplicate"
+)
+
+type MergePeopleRequest struct {
+	// DuplicateID is the person merged into the survivor and removed
+	DuplicateID int
+	// Keep picks the record each attribute comes from, MergeKeepSurvivor or MergeKeepDuplicate. Attributes left
+	// out keep the survivor's value unless it is empty.
+	Keep map[string]string
+}
+
+// How far a merge got, recorded on its audit record
+const (
+	MergePending   = "pending"
+	MergeCompleted = "completed"
+	MergeFailed    = "failed"
+)
+
+// PersonMerge is the audit record of a merge
+type PersonMerge struct {
+	ID         int                   `json:"id,omitempty"`
+	Attributes PersonMergeAttributes `json:"attributes"`
+}
+
+type PersonMergeAttributes struct {
+	SurvivorID int    `json:"survivor_id"`
+	MergedID   int    `json:"merged_id"`
+	MergedBy   string `json:"merged_by"`
+	// Status is MergePending while the merge runs, then MergeCompleted or MergeFailed
+	Status string `json:"status"`
+	// Fields is the record each attribute was taken from
+	Fields map[string]string `json:"fields"`
+	// MergedRecord is the duplicate as it was before it was removed
+	MergedRecord *Person `json:"merged_record"`
+	// JobPosts are the duplicate's job posts that were moved to the survivor
+	JobPosts  []int  `json:"job_posts"`
+	CreatedAt string `json:"createdAt,omitempty"`
+}
+
+// personMerges is the Forge Data API merge audit trail
+var personMerges = Collection[PersonMerge]{Path: "person-merges"}
+
+// MergePeople folds a duplicate person into the survivor, moves the duplicate's job posts over and removes it.
+// The merge is recorded as pending in the audit trail before anything is changed and marked completed or failed
+// once it ends. The survivor is saved before the duplicate is touched so a failed merge never loses the duplicate.
+// encore:api auth method=POST path=/data/people/:id/merge
+func MergePeople(ctx context.Context, id int, req *MergePeopleRequest) (*Person, error) {
+	if err := RequireOrganizer(); err != nil {
+		return nil, err
+	}
+	if req.DuplicateID == id {
+		return nil, &errs.Error{
+			Code:    errs.InvalidArgument,
+			Message: "a person can't be merged into themselves",
+		}
+	}
+
+	survivor, err := loadPersonFresh(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	duplicate, err := loadPersonFresh(ctx, req.DuplicateID)
+	if err != nil {
+		return nil, err
+	}
+	_, fields, err := mergedPersonUpdate(survivor, duplicate, req.Keep)
+	if err != nil {
+		return nil, err
+	}
+	posts, err := jobPostsByPerson(ctx, duplicate.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	mergedBy, _ := auth.UserID()
+	audit := PersonMergeAttributes{
+		SurvivorID:   survivor.ID,
+		MergedID:     duplicate.ID,
+		MergedBy:     string(mergedBy),
+		Status:       MergePending,
+		Fields:       fields,
+		MergedRecord: duplicate,
+		JobPosts:     []int{},
+	}
+	for _, post := range posts {
+		audit.JobPosts = append(audit.JobPosts, post.ID)
+	}
+	record, err := personMerges.Create(ctx, &audit)
+	if err != nil {
+		return nil, err
+	}
+
+	merged, fields, err := mergeIntoSurvivor(ctx, survivor, duplicate, req.Keep)
+	if err != nil {
+		rlog.Error("Error saving merged person, the duplicate was left alone", "survivor", survivor.ID, "duplicate", duplicate.ID, "err", err)
+		finishMergeAudit(ctx, record.ID, &mergeAuditUpdate{Status: MergeFailed})
+		return nil, err
+	}
+	for _, post := range posts {
+		if _, err := jobPosts.Update(ctx, post.ID, &jobPostPersonUpdate{Person: survivor.ID}); err != nil {
+			finishMergeAudit(ctx, record.ID, &mergeAuditUpdate{Status: MergeFailed, Fields: fields})
+			return nil, err
+		}
+	}
+	if err := deletePerson(ctx, duplicate.ID); err != nil {
+		finishMergeAudit(ctx, record.ID, &mergeAuditUpdate{Status: MergeFailed, Fields: fields})
+		return nil, err
+	}
+	finishMergeAudit(ctx, record.ID, &mergeAuditUpdate{Status: MergeCompleted, Fields: fields})
+	rlog.Info("Merged people", "survivor", survivor.ID, "duplicate", duplicate.ID, "job_posts", len(posts))
+	return merged, nil
+}
+
+// mergeAuditUpdate records how a merge ended. Fields is left out if the survivor was never saved.
+type mergeAuditUpdate struct {
+	Status string            `json:"status"`
+	Fields map[string]string `json:"fields,omitempty"`
+}
+
+// finishMergeAudit marks the merge's audit record with how it ended. The merge itself already happened or
+// failed, so an error here is only logged and the record stays pending for an organizer to look at.
+func finishMergeAudit(ctx context.Context, id int, update *mergeAuditUpdate) {
+	if _, err := personMerges.Update(ctx, id, update); err != nil {
+		rlog.Error("Error updating merge audit record", "merge", id, "status", update.Status, "err", err)
+	}
+}
+
+// How many times the survivor's update is reapplied after another flow changed them mid merge
+const mergeUpdateAttempts = 3
+
+// mergeIntoSurvivor saves the merged attributes on the survivor and returns which record each was taken from.
+// If the survivor changed since it was read it is read again and the merge is worked out anew.
+func mergeIntoSurvivor(ctx context.Context, survivor *Person, duplicate *Person, keep map[string]string) (*Person, map[string]string, error) {
+	for attempt := 1; ; attempt++ {
+		update, fields, err := mergedPersonUpdate(survivor, duplicate, keep)
+		if err != nil {
+			return nil, nil, err
+		}
+		update.Version = survivor.Attributes.UpdatedAt
+		merged, err := UpdatePerson(ctx, survivor.ID, update)
+		if err == nil {
+			return merged, fields, nil
+		}
+		if e, ok := err.(*errs.Error); !ok || e.Code != errs.Aborted || attempt == mergeUpdateAttempts {
+			return nil, nil, err
+		}
+		survivor, err = loadPersonFresh(ctx, survivor.ID)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+}
+
+// mergedPersonUpdate works out the survivor's attributes after the merge and which record each came from
+func mergedPersonUpdate(survivor *Person, duplicate *Person, keep map[string]string) (*PersonUpdate, map[string]string, error) {
+	for attribute, side := range keep {
+		if !isMergeableAttribute(attribute) || (side != MergeKeepSurvivor && side != MergeKeepDuplicate) {
+			return nil, nil, &errs.Error{
+				Code:    errs.InvalidArgument,
+				Message: fmt.Sprintf("can't keep %q from %q", attribute, side),
+			}
+		}
+	}
+
+	update := &PersonUpdate{}
+	fields := map[string]string{}
+	for _, attribute := range mergeableAttributes {
+		side, ok := keep[attribute]
+		if !ok {
+			side = MergeKeepSurvivor
+			if attributeValue(survivor, attribute) == "" && attributeValue(duplicate, attribute) != "" {
+				side = MergeKeepDuplicate
+			}
+		}
+		fields[attribute] = side
+		if side == MergeKeepDuplicate {
+			setAttribute(update, attribute, attributeValue(duplicate, attribute))
+		}
+	}
+	return update, fields, nil
+}
+
+func isMergeableAttribute(attribute string) bool {
+	for _, a := range mergeableAttributes {
+		if a == attribute {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,67 @@
+package data
+
+import (
+	"testing"
+
+	"encore.dev/beta/errs"
+)
+
+func testPerson(id int, slackID string, email string, name string) *Person {
+	p := &Person{ID: id}
+	p.Attributes.SlackID = slackID
+	p.Attributes.Email = email
+	p.Attributes.DisplayName = name
+	return p
+}
+
+func TestFindDuplicates(t *testing.T) {
+	migrated := testPerson(7, "U0NEW", "Pete@Example.com ", "soypete")
+	migrated.Attributes.GithubUser = "SoyPete"
+	original := testPerson(3, "UC81JHDJ6", "pete@example.com", "soypete")
+	original.Attributes.GithubUser = "soypete"
+	// Sharing only a name isn't enough
+	namesake := testPerson(9, "U0OTHER", "other@example.com", "soypete")
+
+	pairs := findDuplicates([]*Person{migrated, original, namesake})
+	if len(pairs) != 1 {
+		t.Fatalf("expected one duplicate pair, got %+v", pairs)
+	}
+	got := pairs[0]
+	if got.A != 3 || got.B != 7 || got.Score != 1 {
+		t.Errorf("pair = %+v, expected 3 and 7 with a full score", got)
+	}
+	if len(got.Matches) != 3 || got.Matches[0] != "display_name" || got.Matches[1] != "email" || got.Matches[2] != "github_user" {
+		t.Errorf("matches = %v, expected display_name, email and github_user", got.Matches)
+	}
+}
+
+func TestMergedPersonUpdate(t *testing.T) {
+	survivor := testPerson(3, "UC81JHDJ6", "pete@example.com", "soypete")
+	duplicate := testPerson(7, "U0NEW", "pete@work.example.com", "Pete")
+	duplicate.Attributes.MeetupID = "123"
+	duplicate.Attributes.Bio = "gopher"
+
+	update, fields, err := mergedPersonUpdate(survivor, duplicate, map[string]string{"email": MergeKeepDuplicate, "bio": MergeKeepSurvivor})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if update.Email == nil || *update.Email != "pete@work.example.com" {
+		t.Errorf("expected the duplicate's email to be kept, got %v", update.Email)
+	}
+	if update.MeetupID == nil || *update.MeetupID != "123" {
+		t.Errorf("expected the survivor's missing meetup id to be filled in, got %v", update.MeetupID)
+	}
+	if update.Bio != nil || update.SlackID != nil || update.DisplayName != nil {
+		t.Errorf("expected the survivor's own values to be left alone, got %+v", update)
+	}
+	if fields["bio"] != MergeKeepSurvivor || fields["meetup_id"] != MergeKeepDuplicate || len(fields) != len(mergeableAttributes) {
+		t.Errorf("fields = %v, expected every attribute with its source", fields)
+	}
+
+	for _, keep := range []map[string]string{{"tenant": MergeKeepDuplicate}, {"email": "both"}} {
+		_, _, err := mergedPersonUpdate(survivor, duplicate, keep)
+		if e, ok := err.(*errs.Error); !ok || e.Code != errs.InvalidArgument {
+			t.Errorf("keep %v should be an invalid argument", keep)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package data
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"encore.dev/beta/errs"
+	"encore.dev/rlog"
+)
+
+// The identifiers a person can be found by, in the order ResolveIdentity tries them
+const (
+	IdentifierSlackID    = "slack_id"
+	IdentifierMeetupID   = "meetup_id"
+	IdentifierGithubUser = "github_user"
+	IdentifierEmail      = "email"
+)
+
+// LoadPersonByEmail finds a person by email, ignoring case
+// encore:api private path=/data/identity/email/:email
+func LoadPersonByEmail(ctx context.Context, email string, params *PersonLookupParams) (*Person, error) {
+	return findPersonBy(ctx, IdentifierEmail, email, params.Tenant)
+}
+
+// LoadPersonByGithub finds a person by github user, ignoring case like github does
+// encore:api private path=/data/identity/github/:user
+func LoadPersonByGithub(ctx context.Context, user string, params *PersonLookupParams) (*Person, error) {
+	return findPersonBy(ctx, IdentifierGithubUser, user, params.Tenant)
+}
+
+// LoadPersonByMeetupID finds a person by their meetup member id
+// encore:api private path=/data/identity/meetup/:id
+func LoadPersonByMeetupID(ctx context.Context, id string, params *PersonLookupParams) (*Person, error) {
+	return findPersonBy(ctx, IdentifierMeetupID, id, params.Tenant)
+}
+
+// Identity is everything a caller knows about someone, empty fields are skipped
+type Identity struct {
+	SlackID    string
+	MeetupID   string
+	GithubUser string
+	Email      string
+	// Tenant is the workspace to look in, empty for the original forge workspace
+	Tenant string
+}
+
+type ResolvedIdentity struct {
+	Person *Person
+	// MatchedBy is the identifier that found the person, one of the Identifier* constants
+	MatchedBy string
+}
+
+// ResolveIdentity finds the person behind an identity, trying the identifiers from most to least specific
+// encore:api private method=POST path=/data/identity/resolve
+func ResolveIdentity(ctx context.Context, id *Identity) (*ResolvedIdentity, error) {
+	return resolveIdentity(ctx, id, findPersonBy)
+}
+
+type personFinder func(ctx context.Context, identifier string, value string, tenant string) (*Person, error)
+
+func resolveIdentity(ctx context.Context, id *Identity, find personFinder) (*ResolvedIdentity, error) {
+	tried := []string{}
+	for _, candidate := range []struct {
+		identifier string
+		value      string
+	}{
+		{IdentifierSlackID, id.SlackID},
+		{IdentifierMeetupID, id.MeetupID},
+		{IdentifierGithubUser, id.GithubUser},
+		{IdentifierEmail, id.Email},
+	} {
+		if strings.TrimSpace(candidate.value) == "" {
+			continue
+		}
+		tried = append(tried, candidate.identifier)
+		p, err := find(ctx, candidate.identifier, candidate.value, id.Tenant)
+		if err == nil {
+			return &ResolvedIdentity{Person: p, MatchedBy: candidate.identifier}, nil
+		}
+		if e, ok := err.(*errs.Error); !ok || e.Code != errs.NotFound {
+			return nil, err
+		}
+	}
+
+	if len(tried) == 0 {
+		return nil, &errs.Error{
+			Code:    errs.InvalidArgument,
+			Message: "no identifier to resolve",
+		}
+	}
+	return nil, &errs.Error{
+		Code:    errs.NotFound,
+		Message: fmt.Sprintf("No person matches %s", strings.Join(tried, ", ")),
+	}
+}
+
+// findPersonBy returns the oldest person with the identifier, or errs.NotFound
+func findPersonBy(ctx context.Context, identifier string, value string, tenant string) (*Person, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return nil, &errs.Error{
+			Code:    errs.InvalidArgument,
+			Message: identifier + " is required",
+		}
+	}
+
+	match := Eq(identifier, value)
+	if identifier == IdentifierEmail || identifier == IdentifierGithubUser {
+		match = EqI(identifier, value)
+	}
+	pr, err := people.Find(ctx, NewQuery().Where(match, tenantFilter(tenant)).Sort("id:asc").Page(1, 1))
+	if err != nil {
+		return nil, err
+	}
+	if len(pr.Data) == 0 {
+		rlog.Debug("No person found", "identifier", identifier, "value", value)
+		return nil, &errs.Error{
+			Code:    errs.NotFound,
+			Message: fmt.Sprintf("No person with %s %s", identifier, value),
+		}
+	}
+	return pr.Data[0], nil
+}
@@ -0,0 +1,64 @@
+package data
+
+import (
+	"context"
+	"testing"
+
+	"encore.dev/beta/errs"
+)
+
+// fakeFinder knows one person by each identifier in people
+func fakeFinder(people map[string]*Person, asked *[]string) personFinder {
+	return func(ctx context.Context, identifier string, value string, tenant string) (*Person, error) {
+		*asked = append(*asked, identifier)
+		if p, ok := people[identifier+"="+value]; ok {
+			return p, nil
+		}
+		return nil, &errs.Error{Code: errs.NotFound}
+	}
+}
+
+func TestResolveIdentityMostSpecificFirst(t *testing.T) {
+	bySlack := &Person{ID: 1}
+	byEmail := &Person{ID: 2}
+	asked := []string{}
+	find := fakeFinder(map[string]*Person{
+		"slack_id=UC81JHDJ6":     bySlack,
+		"email=pete@example.com": byEmail,
+	}, &asked)
+
+	got, err := resolveIdentity(context.Background(), &Identity{SlackID: "UC81JHDJ6", Email: "pete@example.com"}, find)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Person != bySlack || got.MatchedBy != IdentifierSlackID {
+		t.Errorf("resolved %+v, expected the slack id match", got)
+	}
+
+	// Unknown identifiers fall through to the next one, empty ones aren't looked up
+	asked = asked[:0]
+	got, err = resolveIdentity(context.Background(), &Identity{MeetupID: "123", Email: "pete@example.com"}, find)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Person != byEmail || got.MatchedBy != IdentifierEmail {
+		t.Errorf("resolved %+v, expected the email match", got)
+	}
+	if len(asked) != 2 || asked[0] != IdentifierMeetupID || asked[1] != IdentifierEmail {
+		t.Errorf("looked up %v, expected meetup_id then email", asked)
+	}
+}
+
+func TestResolveIdentityErrors(t *testing.T) {
+	asked := []string{}
+	find := fakeFinder(map[string]*Person{}, &asked)
+
+	_, err := resolveIdentity(context.Background(), &Identity{GithubUser: "soypete"}, find)
+	if e, ok := err.(*errs.Error); !ok || e.Code != errs.NotFound {
+		t.Errorf("expected NotFound when nothing matches, got %#v", err)
+	}
+	_, err = resolveIdentity(context.Background(), &Identity{Email: "  "}, find)
+	if e, ok := err.(*errs.Error); !ok || e.Code != errs.InvalidArgument {
+		t.Errorf("expected InvalidArgument without identifiers, got %#v", err)
+	}
+}
@@ -0,0 +1,38 @@
+package data
+
+import (
+	"context"
+	"strconv"
+)
+
+// JobPost is a job shared through the job post shortcut, it belongs to the person who posted it
+type JobPost struct {
+	ID         int `json:"id,omitempty"`
+	Attributes struct {
+		Company      string `json:"company"`
+		URL          string `json:"url"`
+		ContactEmail string `json:"contact_email"`
+		Description  string `json:"description"`
+		CreatedAt    string `json:"createdAt,omitempty"`
+		UpdatedAt    string `json:"updatedAt,omitempty"`
+		// Person is only filled in when the query populates it
+		Person struct {
+			Data *struct {
+				ID int `json:"id"`
+			} `json:"data"`
+		} `json:"person"`
+	} `json:"attributes"`
+}
+
+// jobPosts is the Forge Data API job posts collection
+var jobPosts = Collection[JobPost]{Path: "job-posts"}
+
+// jobPostPersonUpdate moves a job post to another person
+type jobPostPersonUpdate struct {
+	Person int `json:"person"`
+}
+
+// jobPostsByPerson returns every job post the person made, oldest first
+func jobPostsByPerson(ctx context.Context, personID int) ([]*JobPost, error) {
+	return jobPosts.FindAll(ctx, NewQuery().Where(Eq("person.id", strconv.Itoa(personID))).Sort("id:asc"))
+}
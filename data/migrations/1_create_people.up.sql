@@ -0,0 +1,20 @@
+-- people mirrors the Forge Data API people collection so lookups don't need a round trip
+CREATE TABLE people (
+    id INTEGER PRIMARY KEY,
+    slack_id TEXT NOT NULL DEFAULT '',
+    -- '' for the original forge workspace
+    tenant TEXT NOT NULL DEFAULT '',
+    -- updatedAt as the api returns it, it doubles as the person's version
+    updated_at TEXT NOT NULL,
+    attributes JSONB NOT NULL,
+    mirrored_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX people_slack_id_idx ON people (slack_id, tenant);
+
+-- mirror_cursors is how far each collection's incremental pull got
+CREATE TABLE mirror_cursors (
+    collection TEXT PRIMARY KEY,
+    updated_at TEXT NOT NULL,
+    synced_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
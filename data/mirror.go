@@ -0,0 +1,312 @@
+package data
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+
+	"encore.dev/rlog"
+	"encore.dev/storage/sqldb"
+)
+
+// The data service keeps a mirror of the people collection in its database so slack interactions don't wait on
+// the Forge Data API. Writes go to the api first and through to the mirror, SyncPeopleMirror pulls what other apps
+// changed and ReconcilePeopleMirror repairs anything both of those missed.
+
+type MirrorSyncResponse struct {
+	// Synced is how many people the pull saved
+	Synced int
+	// Cursor is the updatedAt the next pull starts from
+	Cursor string
+}
+
+// SyncPeopleMirror pulls the people that changed since the last pull into the mirror. People changed at the
+// cursor are pulled again, saving them twice is harmless and none are skipped.
+// encore:api private method=POST path=/data/mirror/people/sync
+func SyncPeopleMirror(ctx context.Context) (*MirrorSyncResponse, error) {
+	cursor, err := mirrorCursor(ctx, people.Path)
+	if err != nil {
+		return nil, err
+	}
+	query := NewQuery().Sort("updatedAt:asc", "id:asc")
+	if cursor != "" {
+		query.Where(Gte("updatedAt", cursor))
+	}
+	changed, err := people.FindAll(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := &MirrorSyncResponse{Cursor: cursor}
+	for _, p := range changed {
+		if err := saveMirroredPerson(ctx, p); err != nil {
+			return ret, err
+		}
+		ret.Synced++
+		if p.Attributes.UpdatedAt > ret.Cursor {
+			ret.Cursor = p.Attributes.UpdatedAt
+		}
+	}
+	if ret.Cursor != cursor {
+		if err := saveMirrorCursor(ctx, people.Path, ret.Cursor); err != nil {
+			return ret, err
+		}
+	}
+	rlog.Info("Synced people mirror", "synced", ret.Synced, "cursor", ret.Cursor)
+	return ret, nil
+}
+
+// MirrorDriftReport lists the people the mirror disagrees with the api about
+type MirrorDriftReport struct {
+	// Checked is how many people the api has
+	Checked int
+	// Missing are people the mirror doesn't have
+	Missing []int
+	// Stale are mirrored people whose version differs from the api's
+	Stale []int
+	// Orphaned are mirrored people the api no longer has
+	Orphaned []int
+}
+
+// ReconcilePeopleMirror compares every person in the mirror with the api, reports the drift and repairs it
+// encore:api private method=POST path=/data/mirror/people/reconcile
+func ReconcilePeopleMirror(ctx context.Context) (*MirrorDriftReport, error) {
+	remote, err := people.FindAll(ctx, NewQuery().Sort("id:asc"))
+	if err != nil {
+		return nil, err
+	}
+	local, err := mirroredVersions(ctx)
+	if err != nil {
+		return nil, err
+	}
+	report := mirrorDrift(remote, local)
+
+	byID := map[int]*Person{}
+	for _, p := range remote {
+		byID[p.ID] = p
+	}
+	for _, id := range append(append([]int{}, report.Missing...), report.Stale...) {
+		if err := saveMirroredPerson(ctx, byID[id]); err != nil {
+			return report, err
+		}
+	}
+	for _, id := range report.Orphaned {
+		if err := deleteMirroredPerson(ctx, id); err != nil {
+			return report, err
+		}
+	}
+	rlog.Info("Reconciled people mirror", "checked", report.Checked, "missing", len(report.Missing),
+		"stale", len(report.Stale), "orphaned", len(report.Orphaned))
+	return report, nil
+}
+
+// mirrorDrift compares the api's people with the mirrored versions by id
+func mirrorDrift(remote []*Person, local map[int]string) *MirrorDriftReport {
+	report := &MirrorDriftReport{Checked: len(remote), Missing: []int{}, Stale: []int{}, Orphaned: []int{}}
+	seen := map[int]bool{}
+	for _, p := range remote {
+		seen[p.ID] = true
+		version, ok := local[p.ID]
+		if !ok {
+			report.Missing = append(report.Missing, p.ID)
+		} else if version != p.Attributes.UpdatedAt {
+			report.Stale = append(report.Stale, p.ID)
+		}
+	}
+	for id := range local {
+		if !seen[id] {
+			report.Orphaned = append(report.Orphaned, id)
+		}
+	}
+	sort.Ints(report.Missing)
+	sort.Ints(report.Stale)
+	sort.Ints(report.Orphaned)
+	return report
+}
+
+// lookupPeopleBySlackID is findPeopleBySlackID served from the mirror. People the mirror doesn't have yet are
+// looked up in the api and mirrored.
+func lookupPeopleBySlackID(ctx context.Context, slackID string, tenant string) ([]*Person, error) {
+	found, err := mirroredPeopleBySlackID(ctx, slackID, tenant)
+	if err != nil {
+		rlog.Error("Error reading people mirror, falling back to the api", "slackID", slackID, "err", err)
+	} else if len(found) > 0 {
+		return found, nil
+	}
+
+	found, err = findPeopleBySlackID(ctx, slackID, tenant)
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range found {
+		mirrorPerson(ctx, p)
+	}
+	return found, nil
+}
+
+// lookupPerson is people.Get served from the mirror
+func lookupPerson(ctx context.Context, id int) (*Person, error) {
+	p, err := mirroredPerson(ctx, id)
+	if err != nil {
+		rlog.Error("Error reading people mirror, falling back to the api", "id", id, "err", err)
+	} else if p != nil {
+		return p, nil
+	}
+
+	p, err = people.Get(ctx, id, nil)
+	if err != nil {
+		return nil, err
+	}
+	mirrorPerson(ctx, p)
+	return p, nil
+}
+
+// createPerson adds a person to the api and the mirror
+func createPerson(ctx context.Context, attributes interface{}) (*Person, error) {
+	p, err := people.Create(ctx, attributes)
+	if err != nil {
+		return nil, err
+	}
+	personWritten(ctx, p)
+	return p, nil
+}
+
+// deletePerson removes a person from the api, the mirror and the cache
+func deletePerson(ctx context.Context, id int) error {
+	if err := people.Delete(ctx, id); err != nil {
+		return err
+	}
+	if err := forgetPerson(ctx, id); err != nil {
+		rlog.Error("Error removing person from mirror, reconciliation will clean it up", "id", id, "err", err)
+	}
+	return nil
+}
+
+// personWritten brings the mirror and the cache up to date with a person the api just saved
+func personWritten(ctx context.Context, p *Person) {
+	personLookups.invalidate(p)
+	mirrorPerson(ctx, p)
+}
+
+// mirrorPerson writes a person the api returned through to the mirror. The api already has the change so a
+// failure is only logged, the next pull picks the person up.
+func mirrorPerson(ctx context.Context, p *Person) {
+	if err := saveMirroredPerson(ctx, p); err != nil {
+		rlog.Error("Error writing person to mirror", "id", p.ID, "err", err)
+	}
+}
+
+// saveMirroredPerson upserts a person, an older version never replaces a newer one
+func saveMirroredPerson(ctx context.Context, p *Person) error {
+	attributes, err := json.Marshal(p.Attributes)
+	if err != nil {
+		return fmt.Errorf("Error marshaling mirrored person %d: %w", p.ID, err)
+	}
+	_, err = sqldb.Exec(ctx, `
+		INSERT INTO people (id, slack_id, tenant, updated_at, attributes, mirrored_at)
+		VALUES ($1, $2, $3, $4, $5, now())
+		ON CONFLICT (id) DO UPDATE SET
+			slack_id = EXCLUDED.slack_id,
+			tenant = EXCLUDED.tenant,
+			updated_at = EXCLUDED.updated_at,
+			attributes = EXCLUDED.attributes,
+			mirrored_at = now()
+		WHERE people.updated_at <= EXCLUDED.updated_at
+	`, p.ID, p.Attributes.SlackID, p.Attributes.Tenant, p.Attributes.UpdatedAt, string(attributes))
+	return err
+}
+
+func deleteMirroredPerson(ctx context.Context, id int) error {
+	_, err := sqldb.Exec(ctx, `DELETE FROM people WHERE id = $1`, id)
+	return err
+}
+
+// mirroredPeopleBySlackID returns the mirrored people with the slack id in the tenant, oldest first
+func mirroredPeopleBySlackID(ctx context.Context, slackID string, tenant string) ([]*Person, error) {
+	rows, err := sqldb.Query(ctx, `
+		SELECT id, attributes FROM people
+		WHERE slack_id = $1 AND tenant = $2
+		ORDER BY id
+	`, slackID, tenant)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	found := []*Person{}
+	for rows.Next() {
+		var id int
+		var attributes []byte
+		if err := rows.Scan(&id, &attributes); err != nil {
+			return nil, err
+		}
+		p, err := decodeMirroredPerson(id, attributes)
+		if err != nil {
+			return nil, err
+		}
+		found = append(found, p)
+	}
+	return found, rows.Err()
+}
+
+// mirroredPerson returns the mirrored person, nil if the mirror doesn't have them
+func mirroredPerson(ctx context.Context, id int) (*Person, error) {
+	var attributes []byte
+	err := sqldb.QueryRow(ctx, `SELECT attributes FROM people WHERE id = $1`, id).Scan(&attributes)
+	if errors.Is(err, sqldb.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return decodeMirroredPerson(id, attributes)
+}
+
+func decodeMirroredPerson(id int, attributes []byte) (*Person, error) {
+	p := &Person{ID: id}
+	if err := json.Unmarshal(attributes, &p.Attributes); err != nil {
+		return nil, fmt.Errorf("Error decoding mirrored person %d: %w", id, err)
+	}
+	return p, nil
+}
+
+// mirroredVersions maps every mirrored person's id to its version
+func mirroredVersions(ctx context.Context) (map[int]string, error) {
+	rows, err := sqldb.Query(ctx, `SELECT id, updated_at FROM people`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	versions := map[int]string{}
+	for rows.Next() {
+		var id int
+		var version string
+		if err := rows.Scan(&id, &version); err != nil {
+			return nil, err
+		}
+		versions[id] = version
+	}
+	return versions, rows.Err()
+}
+
+// mirrorCursor is the updatedAt a collection's last pull got to, empty before the first pull
+func mirrorCursor(ctx context.Context, collection string) (string, error) {
+	var cursor string
+	err := sqldb.QueryRow(ctx, `SELECT updated_at FROM mirror_cursors WHERE collection = $1`, collection).Scan(&cursor)
+	if errors.Is(err, sqldb.ErrNoRows) {
+		return "", nil
+	}
+	return cursor, err
+}
+
+func saveMirrorCursor(ctx context.Context, collection string, cursor string) error {
+	_, err := sqldb.Exec(ctx, `
+		INSERT INTO mirror_cursors (collection, updated_at, synced_at)
+		VALUES ($1, $2, now())
+		ON CONFLICT (collection) DO UPDATE SET updated_at = EXCLUDED.updated_at, synced_at = now()
+	`, collection, cursor)
+	return err
+}
@@ -0,0 +1,30 @@
+package data
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMirrorDrift(t *testing.T) {
+	person := func(id int, version string) *Person {
+		p := &Person{ID: id}
+		p.Attributes.UpdatedAt = version
+		return p
+	}
+	remote := []*Person{
+		person(1, "2023-03-01T00:00:00.000Z"),
+		person(2, "2023-03-02T00:00:00.000Z"),
+		person(3, "2023-03-03T00:00:00.000Z"),
+	}
+	local := map[int]string{
+		1: "2023-03-01T00:00:00.000Z",
+		3: "2023-02-01T00:00:00.000Z",
+		4: "2023-01-01T00:00:00.000Z",
+	}
+
+	got := mirrorDrift(remote, local)
+	want := &MirrorDriftReport{Checked: 3, Missing: []int{2}, Stale: []int{3}, Orphaned: []int{4}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("mirrorDrift() = %+v, expected %+v", got, want)
+	}
+}
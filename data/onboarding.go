@@ -0,0 +1,162 @@
+package data
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"encore.dev/rlog"
+)
+
+// Onboarding statuses stored on the person
+const (
+	OnboardingWelcomed   = "welcomed"
+	OnboardingFollowedUp = "followed_up"
+	OnboardingCompleted  = "completed"
+)
+
+// How long to wait before following up when organizers haven't set follow_up_days
+const defaultFollowUpDays = 7
+
+// OnboardingContent is the organizer editable welcome DM, stored in the onboarding single type
+type OnboardingContent struct {
+	WelcomeMessage   string              `json:"welcome_message"`
+	CodeOfConductURL string              `json:"code_of_conduct_url"`
+	Channels         []OnboardingChannel `json:"channels"`
+	FollowUpDays     int                 `json:"follow_up_days"`
+	FollowUpMessage  string              `json:"follow_up_message"`
+}
+
+// OnboardingChannel is a channel we recommend to new members
+type OnboardingChannel struct {
+	ChannelID   string `json:"channel_id"`
+	Description string `json:"description"`
+}
+
+type OnboardingContentResponse struct {
+	Data struct {
+		ID         int               `json:"id"`
+		Attributes OnboardingContent `json:"attributes"`
+	} `json:"data"`
+}
+
+type UpdateOnboardingContentRequest struct {
+	Data *OnboardingContent `json:"data"`
+}
+
+// LoadOnboardingContent loads the welcome DM content
+// encore:api private path=/data/onboarding
+func LoadOnboardingContent(ctx context.Context) (*OnboardingContent, error) {
+	body, _, err := HttpRequest(ctx, "GET", "onboarding?populate=*", nil)
+	if err != nil {
+		rlog.Error("Error loading onboarding content", "err", err)
+		return nil, err
+	}
+	ocr := &OnboardingContentResponse{}
+	err = json.Unmarshal(body, &ocr)
+	if err != nil {
+		rlog.Error("Error decoding onboarding content response", "err", err)
+		return nil, fmt.Errorf("Error decoding onboarding content response: %s", err)
+	}
+	if ocr.Data.Attributes.FollowUpDays <= 0 {
+		ocr.Data.Attributes.FollowUpDays = defaultFollowUpDays
+	}
+
+	return &ocr.Data.Attributes, nil
+}
+
+// UpdateOnboardingContent lets organizers change the welcome DM content
+// encore:api auth method=PUT path=/data/onboarding
+func UpdateOnboardingContent(ctx context.Context, c *OnboardingContent) (*OnboardingContent, error) {
+	if err := RequireOrganizer(); err != nil {
+		return nil, err
+	}
+
+	jsonReq, err := json.Marshal(&UpdateOnboardingContentRequest{Data: c})
+	if err != nil {
+		rlog.Error("Error marshaling onboarding content request", "err", err)
+		return nil, fmt.Errorf("Error marshaling onboarding content request: %s", err)
+	}
+	body, _, err := HttpRequest(ctx, "PUT", "onboarding?populate=*", jsonReq)
+	if err != nil {
+		rlog.Error("Error updating onboarding content", "err", err)
+		return nil, err
+	}
+	ocr := &OnboardingContentResponse{}
+	err = json.Unmarshal(body, &ocr)
+	if err != nil {
+		rlog.Error("Error decoding onboarding content response", "err", err)
+		return nil, fmt.Errorf("Error decoding onboarding content response: %s", err)
+	}
+
+	return &ocr.Data.Attributes, nil
+}
+
+type OnboardingFollowUpParams struct {
+	// StartedBefore is an RFC 3339 time, people welcomed before it are due a follow up
+	StartedBefore string `query:"started_before"`
+	// Tenant is the workspace to look in, empty for the original forge workspace
+	Tenant string `query:"tenant"`
+}
+
+type OnboardingPeople struct {
+	People []*Person
+}
+
+// ListPeopleDueOnboardingFollowUp returns the people that were welcomed before the given time and haven't
+// had a follow up yet
+// encore:api private path=/data/onboarding/follow-ups
+func ListPeopleDueOnboardingFollowUp(ctx context.Context, params *OnboardingFollowUpParams) (*OnboardingPeople, error) {
+	ret := &OnboardingPeople{}
+	query := NewQuery().Where(
+		tenantFilter(params.Tenant),
+		Eq("onboarding_status", OnboardingWelcomed),
+		Lt("onboarding_started_at", params.StartedBefore),
+	).Sort("id:asc")
+
+	found, err := people.FindAll(ctx, query)
+	if err != nil {
+		return ret, err
+	}
+	ret.People = found
+	return ret, nil
+}
+
+type OnboardingStatsParams struct {
+	// Tenant is the workspace to count, empty for the original forge workspace
+	Tenant string `query:"tenant"`
+}
+
+type OnboardingStatsResponse struct {
+	Welcomed   int
+	FollowedUp int
+	Completed  int
+	// CompletionRate is the share of onboarded people that completed their profile
+	CompletionRate float64
+}
+
+// OnboardingStats shows organizers how many new members finish onboarding
+// encore:api auth path=/data/onboarding/stats
+func OnboardingStats(ctx context.Context, params *OnboardingStatsParams) (*OnboardingStatsResponse, error) {
+	if err := RequireOrganizer(); err != nil {
+		return nil, err
+	}
+
+	ret := &OnboardingStatsResponse{}
+	for status, count := range map[string]*int{
+		OnboardingWelcomed:   &ret.Welcomed,
+		OnboardingFollowedUp: &ret.FollowedUp,
+		OnboardingCompleted:  &ret.Completed,
+	} {
+		pr, err := people.Find(ctx, NewQuery().Where(tenantFilter(params.Tenant), Eq("onboarding_status", status)).Page(1, 1))
+		if err != nil {
+			return nil, err
+		}
+		*count = pr.Meta.Pagination.Total
+	}
+
+	if total := ret.Welcomed + ret.FollowedUp + ret.Completed; total > 0 {
+		ret.CompletionRate = float64(ret.Completed) / float64(total)
+	}
+	return ret, nil
+}
@@ -2,16 +2,20 @@ package data
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"strconv"
 
+	"encore.dev/beta/auth"
 	"encore.dev/beta/errs"
 	"encore.dev/rlog"
 )
 
-type PeopleResponse struct {
-	Data []*Person `json:"data"`
+// Pagination is the strapi pagination metadata on list responses
+type Pagination struct {
+	Page      int `json:"page"`
+	PageSize  int `json:"pageSize"`
+	PageCount int `json:"pageCount"`
+	Total     int `json:"total"`
 }
 
 // Person struct from this data: {\"display_name\":\"soypete\",\"bio\":null,\"github_user\":null,\"twitter_handle\":null,\"createdAt\":\"2023-01-25T23:30:39.795Z\",\"updatedAt\":\"2023-02-28T02:34:11.217Z\",\"publishedAt\":\"2023-02-17T19:50:42.535Z\",\"slack_id\":\"soypete\",\"meetup_id\":null}
@@ -28,108 +32,225 @@ type Person struct {
 		SlackID       string `json:"slack_id"`
 		MeetupID      string `json:"meetup_id"`
 		Email         string `json:"email"`
+		LinkedinURL   string `json:"linkedin_url"`
+		// Tenant is the slack workspace the person belongs to, empty for the original forge workspace
+		Tenant string `json:"tenant"`
+		// Inactive is set when the member is deactivated in slack, we keep their record
+		Inactive bool `json:"inactive"`
+		// ErasedAt is set when the member had their personal data erased, slack syncs leave them alone after that
+		ErasedAt string `json:"erased_at,omitempty"`
+		// Onboarding progress, see the Onboarding* statuses
+		OnboardingStatus      string `json:"onboarding_status"`
+		OnboardingStartedAt   string `json:"onboarding_started_at,omitempty"`
+		OnboardingCompletedAt string `json:"onboarding_completed_at,omitempty"`
 	} `json:"attributes"`
 }
 
-// Load a user by slack handle. If user does not exist, create a new user and populate with info from slack
+type PersonLookupParams struct {
+	// Tenant is the workspace to look in, empty for the original forge workspace
+	Tenant string `query:"tenant"`
+	// Fresh skips the cache and the mirror and reads the api, public callers need a service or organizer key
+	Fresh bool `query:"fresh"`
+}
+
+// Load a user by slack handle. Callers without a service or organizer api key only get the public profile.
 //encore:api public path=/data/users/:slackID
-func LoadUserBySlackID(ctx context.Context, slackID string) (*Person, error) {
-	ret := &Person{}
+func LoadUserBySlackID(ctx context.Context, slackID string, params *PersonLookupParams) (*Person, error) {
+	d, _ := auth.Data().(*AuthData)
+	lookup := *params
+	if checkRole(d, RoleService, RoleOrganizer) != nil {
+		lookup.Fresh = false
+	}
+	p, err := LoadPersonBySlackID(ctx, slackID, &lookup)
+	if err != nil {
+		return p, err
+	}
+	return personView(d, p), nil
+}
+
+// personView is what the caller may see of a person, the whole record for services and organizers
+func personView(d *AuthData, p *Person) *Person {
+	if checkRole(d, RoleService, RoleOrganizer) == nil {
+		return p
+	}
+	return publicProfile(p)
+}
+
+// publicProfile only keeps what members show on their forge profile
+func publicProfile(p *Person) *Person {
+	ret := &Person{ID: p.ID}
+	ret.Attributes.SlackID = p.Attributes.SlackID
+	ret.Attributes.DisplayName = p.Attributes.DisplayName
+	ret.Attributes.Bio = p.Attributes.Bio
+	ret.Attributes.GithubUser = p.Attributes.GithubUser
+	ret.Attributes.TwitterHandle = p.Attributes.TwitterHandle
+	ret.Attributes.LinkedinURL = p.Attributes.LinkedinURL
+	return ret
+}
+
+// LoadPersonBySlackID loads the whole person for a slack id, for the other forge services
+// encore:api private path=/data/users/:slackID/person
+func LoadPersonBySlackID(ctx context.Context, slackID string, params *PersonLookupParams) (*Person, error) {
+	key := slackPersonKey(params.Tenant, slackID)
+	if params.Fresh {
+		p, err := canonicalPersonBySlackID(ctx, slackID, params.Tenant, findPeopleBySlackID)
+		if err != nil {
+			return &Person{}, err
+		}
+		mirrorPerson(ctx, p)
+		personLookups.put(key, p)
+		return p, nil
+	}
 
-	// Load user from Forge Data API
-	// Create a new http client and make request
-	body, _, err := HttpRequest("GET", "people?filters[slack_id][$eq]="+slackID, nil)
+	p, err := personLookups.get(ctx, key, func(ctx context.Context) (*Person, error) {
+		return canonicalPersonBySlackID(ctx, slackID, params.Tenant, lookupPeopleBySlackID)
+	})
 	if err != nil {
-		rlog.Error("Error creating person data api request", "err", err)
-		return ret, err
+		return &Person{}, err
 	}
-	rlog.Debug("Person Search Response", "body", string(body))
+	return p, nil
+}
 
-	// decode body to PeopleResponse struct
-	pr := &PeopleResponse{}
-	err = json.Unmarshal(body, &pr)
+// canonicalPersonBySlackID returns the person for a slack id from the people find returns
+func canonicalPersonBySlackID(ctx context.Context, slackID string, tenant string, find func(ctx context.Context, slackID string, tenant string) ([]*Person, error)) (*Person, error) {
+	people, err := find(ctx, slackID, tenant)
 	if err != nil {
-		rlog.Error("Error decoding person search response", "err", err)
-		return ret, err
+		return nil, err
 	}
-	if len(pr.Data) == 0 {
+	if len(people) == 0 {
 		// gotta create a new user
 		rlog.Debug("No person found", "slackID", slackID)
-		return ret, &errs.Error{
+		return nil, &errs.Error{
 			Code:    errs.NotFound,
 			Message: fmt.Sprintf("User not found: %s", slackID),
 		}
 	}
 
-	rlog.Debug("Person Search Response", "body", string(body))
-
-	return pr.Data[0], nil
+	// The oldest record is the canonical one if duplicates slipped in
+	return people[0], nil
 }
 
-// encore:api public method=POST path=/data/people
-func CreatePerson(ctx context.Context, p *Person) (*Person, error) {
-	ret := &Person{}
+// people is the Forge Data API people collection
+var people = Collection[Person]{Path: "people"}
 
-	personRequest := &CreatePersonRequest{}
-	personRequest.Data.SlackID = p.Attributes.SlackID
-	personRequest.Data.DisplayName = p.Attributes.DisplayName
-	personRequest.Data.Email = p.Attributes.Email
-	// Create new io reader from request
-	jsonReq, err := json.Marshal(personRequest)
+// findPeopleBySlackID returns every person with the slack id in the tenant, oldest first
+func findPeopleBySlackID(ctx context.Context, slackID string, tenant string) ([]*Person, error) {
+	pr, err := people.Find(ctx, NewQuery().Where(Eq("slack_id", slackID), tenantFilter(tenant)).Sort("id:asc"))
 	if err != nil {
-		rlog.Error("Error marshaling person data api request", "err", err)
-		return ret, fmt.Errorf("Error marshaling person data api request: %s", err)
+		return nil, err
 	}
+	return pr.Data, nil
+}
 
-	// Load user from Forge Data API
-	body, _, err := HttpRequest("POST", "people", jsonReq)
-	if err != nil {
-		rlog.Error("Error creating person", "err", err)
-		return ret, err
+// tenantFilter limits a people search to one tenant. People of the original workspace were stored
+// before tenants existed so they are the ones without a tenant.
+func tenantFilter(tenant string) Filter {
+	if tenant == "" {
+		return Null("tenant")
 	}
-	rlog.Debug("Person Create Response", "body", string(body))
-	cpr := &CreatePersonResponse{}
-	err = json.Unmarshal(body, &cpr)
-	if err != nil {
-		rlog.Error("Error decoding person create response", "err", err)
-		return ret, fmt.Errorf("Error decoding person create response: %s", err)
+	return Eq("tenant", tenant)
+}
+
+type LoadPersonParams struct {
+	// Fresh skips the cache and the mirror and reads the api, e.g. to get the version an update is checked against
+	Fresh bool `query:"fresh"`
+}
+
+// LoadPerson loads a person by their data api id
+// encore:api private path=/data/people/:id
+func LoadPerson(ctx context.Context, id int, params *LoadPersonParams) (*Person, error) {
+	if params.Fresh {
+		return loadPersonFresh(ctx, id)
 	}
+	return personLookups.get(ctx, idPersonKey(id), func(ctx context.Context) (*Person, error) {
+		return lookupPerson(ctx, id)
+	})
+}
 
-	return cpr.Data, nil
+// loadPersonFresh loads a person from the api for reads that can't work with a cached copy
+func loadPersonFresh(ctx context.Context, id int) (*Person, error) {
+	p, err := people.Get(ctx, id, nil)
+	if err != nil {
+		return nil, err
+	}
+	mirrorPerson(ctx, p)
+	personLookups.put(idPersonKey(id), p)
+	return p, nil
 }
 
-// encore:api private method=PUT path=/data/people/:id
-func UpdatePerson(ctx context.Context, id int, p *Person) (*Person, error) {
-	ret := &Person{}
+// CreatePerson adds a person, only services and organizers can
+// encore:api auth method=POST path=/data/people
+func CreatePerson(ctx context.Context, p *Person) (*Person, error) {
+	if err := requireRole(RoleService, RoleOrganizer); err != nil {
+		return nil, err
+	}
 	personRequest := &CreatePersonRequest{}
 	personRequest.Data.SlackID = p.Attributes.SlackID
 	personRequest.Data.DisplayName = p.Attributes.DisplayName
 	personRequest.Data.Email = p.Attributes.Email
-	// Create new io reader from request
-	jsonReq, err := json.Marshal(personRequest)
-	if err != nil {
-		rlog.Error("Error marshaling person data api request", "err", err)
-		return ret, fmt.Errorf("Error marshaling person data api request: %s", err)
-	}
+	return createPerson(ctx, &personRequest.Data)
+}
 
+// Updates to the same person are serialized so the version check and the write happen together. The lock only
+// covers this instance, strapi has no conditional update to do the check and the write in one step.
+var personUpdateLocks keyedMutex
+
+// UpdatePerson only sends the attributes that are set on the update so it doesn't wipe fields owned by other flows.
+// When the update carries the updatedAt version the caller read, it fails with errs.Aborted if the person changed since.
+// The check is only airtight against writers in the same instance: another instance, or another app writing to the
+// Forge Data API, can still change the person between the check and the write, and the later write wins.
+// encore:api private method=PUT path=/data/people/:id
+func UpdatePerson(ctx context.Context, id int, p *PersonUpdate) (*Person, error) {
+	ret := &Person{}
 	stringID := strconv.Itoa(id)
 
-	// Load user from Forge Data API
-	body, _, err := HttpRequest("PUT", "people/"+stringID, jsonReq)
-	if err != nil {
-		rlog.Error("Error updating person", "err", err)
-		return ret, err
+	unlock := personUpdateLocks.Lock(stringID)
+	defer unlock()
+
+	if p.Version != "" {
+		// The version is checked against the api, the mirror may lag behind it
+		current, err := people.Get(ctx, id, nil)
+		if err != nil {
+			return ret, err
+		}
+		if current.Attributes.UpdatedAt != p.Version {
+			rlog.Debug("Person update conflict", "id", id, "version", p.Version, "current", current.Attributes.UpdatedAt)
+			return ret, &errs.Error{
+				Code:    errs.Aborted,
+				Message: fmt.Sprintf("Person %d was modified since %s", id, p.Version),
+			}
+		}
 	}
-	rlog.Debug("Person Update Response", "body", string(body))
-	cpr := &CreatePersonResponse{}
-	err = json.Unmarshal(body, &cpr)
+
+	updated, err := people.Update(ctx, id, p)
 	if err != nil {
-		rlog.Error("Error decoding person update response", "err", err)
-		return ret, fmt.Errorf("Error decoding person update response: %s", err)
+		return ret, err
 	}
+	personWritten(ctx, updated)
+	return updated, nil
+}
 
-	return cpr.Data, nil
+// PersonUpdate is a partial update of a person. Nil fields are left out of the request
+// so the data api keeps their current value, an empty string clears the field.
+type PersonUpdate struct {
+	// Version is the updatedAt value the caller read, leave empty to update unconditionally
+	Version string `header:"If-Match" json:"-"`
 
+	DisplayName   *string `json:"display_name,omitempty"`
+	Bio           *string `json:"bio,omitempty"`
+	GithubUser    *string `json:"github_user,omitempty"`
+	TwitterHandle *string `json:"twitter_handle,omitempty"`
+	SlackID       *string `json:"slack_id,omitempty"`
+	MeetupID      *string `json:"meetup_id,omitempty"`
+	Email         *string `json:"email,omitempty"`
+	LinkedinURL   *string `json:"linkedin_url,omitempty"`
+	Tenant        *string `json:"tenant,omitempty"`
+	Inactive      *bool   `json:"inactive,omitempty"`
+	ErasedAt      *string `json:"erased_at,omitempty"`
+
+	OnboardingStatus      *string `json:"onboarding_status,omitempty"`
+	OnboardingStartedAt   *string `json:"onboarding_started_at,omitempty"`
+	OnboardingCompletedAt *string `json:"onboarding_completed_at,omitempty"`
 }
 
 type CreatePersonRequest struct {
@@ -146,7 +267,3 @@ type CreatePersonRequest struct {
 		Email         string `json:"email"`
 	} `json:"data"`
 }
-
-type CreatePersonResponse struct {
-	Data *Person
-}
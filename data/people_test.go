@@ -0,0 +1,39 @@
+package data
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestUpdatePersonRequestOmitsUnsetFields(t *testing.T) {
+	displayName := "soypete"
+	email := "pete@example.com"
+	req := &entityRequest{Data: &PersonUpdate{DisplayName: &displayName, Email: &email}}
+
+	b, err := json.Marshal(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got struct {
+		Data map[string]string `json:"data"`
+	}
+	if err := json.Unmarshal(b, &got); err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Data) != 2 || got.Data["display_name"] != displayName || got.Data["email"] != email {
+		t.Errorf("json.Marshal(%+v) = %s, expected only display_name and email", req, b)
+	}
+}
+
+func TestUpdatePersonRequestSendsExplicitEmpty(t *testing.T) {
+	empty := ""
+	req := &entityRequest{Data: &PersonUpdate{Bio: &empty}}
+
+	b, err := json.Marshal(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := string(b), `{"data":{"bio":""}}`; got != want {
+		t.Errorf("json.Marshal(%+v) = %s, expected %s", req, got, want)
+	}
+}
@@ -0,0 +1,98 @@
+package data
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"encore.dev/rlog"
+)
+
+// PersonDataExport is everything the Forge Data API holds about a member
+type PersonDataExport struct {
+	// People is normally one record, duplicates that haven't been merged yet are included
+	People   []*Person
+	JobPosts []*JobPost
+}
+
+// ExportPersonData collects a member's records for a personal data export
+// encore:api private path=/data/users/:slackID/export
+func ExportPersonData(ctx context.Context, slackID string, params *PersonLookupParams) (*PersonDataExport, error) {
+	found, err := findPeopleBySlackID(ctx, slackID, params.Tenant)
+	if err != nil {
+		return nil, err
+	}
+	ret := &PersonDataExport{People: found, JobPosts: []*JobPost{}}
+	for _, p := range found {
+		posts, err := jobPostsByPerson(ctx, p.ID)
+		if err != nil {
+			return nil, err
+		}
+		ret.JobPosts = append(ret.JobPosts, posts...)
+	}
+	return ret, nil
+}
+
+type ErasePersonDataResponse struct {
+	People   int
+	JobPosts int
+}
+
+// ErasePersonData removes a member's personal data. Their job posts are deleted and their person is anonymized
+// rather than deleted, so the slack id stays marked as erased and syncs don't bring the data back.
+// encore:api private method=POST path=/data/users/:slackID/erase
+func ErasePersonData(ctx context.Context, slackID string, params *PersonLookupParams) (*ErasePersonDataResponse, error) {
+	found, err := findPeopleBySlackID(ctx, slackID, params.Tenant)
+	if err != nil {
+		return nil, err
+	}
+	ret := &ErasePersonDataResponse{}
+	for _, p := range found {
+		posts, err := jobPostsByPerson(ctx, p.ID)
+		if err != nil {
+			return ret, err
+		}
+		for _, post := range posts {
+			if err := jobPosts.Delete(ctx, post.ID); err != nil {
+				return ret, err
+			}
+			ret.JobPosts++
+		}
+
+		// Merges into this person kept a copy of the duplicate they replaced
+		merges, err := personMerges.FindAll(ctx, NewQuery().Where(Eq("survivor_id", strconv.Itoa(p.ID))))
+		if err != nil {
+			return ret, err
+		}
+		for _, m := range merges {
+			if _, err := personMerges.Update(ctx, m.ID, &mergedRecordErasure{}); err != nil {
+				return ret, err
+			}
+		}
+
+		if _, err := UpdatePerson(ctx, p.ID, erasedPersonUpdate(time.Now())); err != nil {
+			return ret, err
+		}
+		ret.People++
+	}
+	rlog.Info("Erased personal data", "slackID", slackID, "people", ret.People, "job_posts", ret.JobPosts)
+	return ret, nil
+}
+
+// mergedRecordErasure clears the duplicate snapshot of a merge audit record
+type mergedRecordErasure struct {
+	MergedRecord *Person `json:"merged_record"`
+}
+
+// erasedPersonUpdate clears every attribute that could identify the member, only the slack id is kept
+func erasedPersonUpdate(now time.Time) *PersonUpdate {
+	u := &PersonUpdate{}
+	for _, attribute := range mergeableAttributes {
+		if attribute != "slack_id" {
+			setAttribute(u, attribute, "")
+		}
+	}
+	erasedAt := now.UTC().Format(time.RFC3339)
+	u.ErasedAt = &erasedAt
+	return u
+}
@@ -0,0 +1,31 @@
+package data
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestErasedPersonUpdateClearsPersonalData(t *testing.T) {
+	u := erasedPersonUpdate(time.Date(2023, 3, 1, 12, 0, 0, 0, time.UTC))
+
+	b, err := json.Marshal(u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]interface{}{}
+	if err := json.Unmarshal(b, &got); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := got["slack_id"]; ok {
+		t.Errorf("the slack id has to be kept so syncs know the member was erased, got %s", b)
+	}
+	if got["erased_at"] != "2023-03-01T12:00:00Z" {
+		t.Errorf("erased_at = %v", got["erased_at"])
+	}
+	for _, attribute := range []string{"display_name", "bio", "github_user", "twitter_handle", "meetup_id", "email", "linkedin_url"} {
+		if value, ok := got[attribute]; !ok || value != "" {
+			t.Errorf("%s = %v, expected it to be cleared", attribute, value)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package data
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"encore.dev/beta/errs"
+)
+
+// Strapi caps page sizes at 100 unless configured otherwise
+const maxPeoplePageSize = 100
+
+// peopleSortFields are the sorts ListPeople accepts and the attribute each one orders by
+var peopleSortFields = map[string]string{
+	"created": "createdAt",
+	"updated": "updatedAt",
+}
+
+type ListPeopleParams struct {
+	// Page starts at 1
+	Page     int `query:"page"`
+	PageSize int `query:"pageSize"`
+	// Search matches part of the display name, email or github user, or the whole meetup id
+	Search string `query:"search"`
+	// Sort is created or updated, prefix it with - for newest first
+	Sort string `query:"sort"`
+}
+
+type PeoplePage struct {
+	People     []*Person
+	Pagination Pagination
+}
+
+// ListPeople lets organizers browse and search the community's members
+// encore:api auth method=GET path=/data/people
+func ListPeople(ctx context.Context, params *ListPeopleParams) (*PeoplePage, error) {
+	if err := RequireOrganizer(); err != nil {
+		return nil, err
+	}
+	query, err := listPeopleQuery(params)
+	if err != nil {
+		return nil, err
+	}
+	pr, err := people.Find(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	return &PeoplePage{People: pr.Data, Pagination: pr.Meta.Pagination}, nil
+}
+
+// listPeopleQuery turns the listing params into a strapi query, rejecting sorts and page sizes strapi wouldn't take
+func listPeopleQuery(params *ListPeopleParams) (*Query, error) {
+	if params.Page < 0 || params.PageSize < 0 || params.PageSize > maxPeoplePageSize {
+		return nil, &errs.Error{
+			Code:    errs.InvalidArgument,
+			Message: fmt.Sprintf("page must be positive and pageSize at most %d", maxPeoplePageSize),
+		}
+	}
+	query := NewQuery().Page(params.Page, params.PageSize)
+
+	if search := strings.TrimSpace(params.Search); search != "" {
+		query.Where(Or(
+			ContainsI("display_name", search),
+			ContainsI("email", search),
+			ContainsI("github_user", search),
+			Eq("meetup_id", search),
+		))
+	}
+
+	if params.Sort == "" {
+		return query.Sort("id:asc"), nil
+	}
+	field, order := params.Sort, "asc"
+	if strings.HasPrefix(field, "-") {
+		field, order = field[1:], "desc"
+	}
+	attribute, ok := peopleSortFields[field]
+	if !ok {
+		return nil, &errs.Error{
+			Code:    errs.InvalidArgument,
+			Message: fmt.Sprintf("can't sort people by %q, use created or updated", params.Sort),
+		}
+	}
+	// Ties keep a stable order across pages
+	return query.Sort(attribute+":"+order, "id:asc"), nil
+}
@@ -0,0 +1,42 @@
+package data
+
+import (
+	"net/url"
+	"testing"
+
+	"encore.dev/beta/errs"
+)
+
+func TestListPeopleQuery(t *testing.T) {
+	q, err := listPeopleQuery(&ListPeopleParams{Page: 2, PageSize: 50, Search: " pete ", Sort: "-updated"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := url.Values{
+		"filters[$or][0][display_name][$containsi]": {"pete"},
+		"filters[$or][1][email][$containsi]":        {"pete"},
+		"filters[$or][2][github_user][$containsi]":  {"pete"},
+		"filters[$or][3][meetup_id][$eq]":           {"pete"},
+		"sort[0]":                                   {"updatedAt:desc"},
+		"sort[1]":                                   {"id:asc"},
+		"pagination[page]":                          {"2"},
+		"pagination[pageSize]":                      {"50"},
+	}
+	if got := q.Values(); got.Encode() != want.Encode() {
+		t.Errorf("q.Values() = %v, expected %v", got, want)
+	}
+}
+
+func TestListPeopleQueryRejectsBadParams(t *testing.T) {
+	for _, params := range []*ListPeopleParams{
+		{Sort: "email"},
+		{Sort: "-"},
+		{PageSize: maxPeoplePageSize + 1},
+		{Page: -1},
+	} {
+		_, err := listPeopleQuery(params)
+		if e, ok := err.(*errs.Error); !ok || e.Code != errs.InvalidArgument {
+			t.Errorf("listPeopleQuery(%+v) should be an invalid argument", params)
+		}
+	}
+}
@@ -0,0 +1,286 @@
+package data
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"encore.dev/rlog"
+)
+
+// Collection is a strapi collection type in the Forge Data API, e.g. Collection[Person]{Path: "people"}.
+// T is the entity as strapi returns it, an id plus attributes.
+type Collection[T any] struct {
+	Path string
+}
+
+// ListResponse is a page of a collection
+type ListResponse[T any] struct {
+	Data []*T `json:"data"`
+	Meta struct {
+		Pagination Pagination `json:"pagination"`
+	} `json:"meta"`
+}
+
+type entityResponse[T any] struct {
+	Data *T `json:"data"`
+}
+
+type entityRequest struct {
+	Data interface{} `json:"data"`
+}
+
+// Find returns the page of the collection matching q
+func (c Collection[T]) Find(ctx context.Context, q *Query) (*ListResponse[T], error) {
+	body, _, err := HttpRequest(ctx, "GET", c.Path+"?"+q.Encode(), nil)
+	if err != nil {
+		rlog.Error("Error listing "+c.Path, "err", err)
+		return nil, err
+	}
+	lr := &ListResponse[T]{}
+	err = json.Unmarshal(body, lr)
+	if err != nil {
+		rlog.Error("Error decoding "+c.Path+" list response", "err", err)
+		return nil, fmt.Errorf("Error decoding %s list response: %s", c.Path, err)
+	}
+	return lr, nil
+}
+
+// FindAll pages through everything matching q, q's page size is kept
+func (c Collection[T]) FindAll(ctx context.Context, q *Query) ([]*T, error) {
+	all := []*T{}
+	pageSize := q.pageSize
+	if pageSize == 0 {
+		pageSize = 100
+	}
+	for page := 1; ; page++ {
+		lr, err := c.Find(ctx, q.Page(page, pageSize))
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, lr.Data...)
+		if page >= lr.Meta.Pagination.PageCount {
+			return all, nil
+		}
+	}
+}
+
+// Get loads one entity by id, q may be nil or only set populate and fields
+func (c Collection[T]) Get(ctx context.Context, id int, q *Query) (*T, error) {
+	path := c.Path + "/" + strconv.Itoa(id)
+	if q != nil {
+		path += "?" + q.Encode()
+	}
+	body, _, err := HttpRequest(ctx, "GET", path, nil)
+	if err != nil {
+		rlog.Error("Error loading "+c.Path, "id", id, "err", err)
+		return nil, err
+	}
+	return c.decode(body, "load")
+}
+
+// Create adds an entity, attributes is marshaled as the request's data
+func (c Collection[T]) Create(ctx context.Context, attributes interface{}) (*T, error) {
+	return c.write(ctx, "POST", c.Path, attributes, "create")
+}
+
+// Update changes an entity, strapi leaves attributes missing from the request alone
+func (c Collection[T]) Update(ctx context.Context, id int, attributes interface{}) (*T, error) {
+	return c.write(ctx, "PUT", c.Path+"/"+strconv.Itoa(id), attributes, "update")
+}
+
+// Delete removes an entity
+func (c Collection[T]) Delete(ctx context.Context, id int) error {
+	_, _, err := HttpRequest(ctx, "DELETE", c.Path+"/"+strconv.Itoa(id), nil)
+	if err != nil {
+		rlog.Error("Error deleting "+c.Path, "id", id, "err", err)
+		return err
+	}
+	return nil
+}
+
+func (c Collection[T]) write(ctx context.Context, method string, path string, attributes interface{}, action string) (*T, error) {
+	jsonReq, err := json.Marshal(&entityRequest{Data: attributes})
+	if err != nil {
+		rlog.Error("Error marshaling "+c.Path+" "+action+" request", "err", err)
+		return nil, fmt.Errorf("Error marshaling %s %s request: %s", c.Path, action, err)
+	}
+	body, _, err := HttpRequest(ctx, method, path, jsonReq)
+	if err != nil {
+		rlog.Error("Error sending "+c.Path+" "+action, "err", err)
+		return nil, err
+	}
+	return c.decode(body, action)
+}
+
+func (c Collection[T]) decode(body []byte, action string) (*T, error) {
+	er := &entityResponse[T]{}
+	err := json.Unmarshal(body, er)
+	if err != nil {
+		rlog.Error("Error decoding "+c.Path+" "+action+" response", "err", err)
+		return nil, fmt.Errorf("Error decoding %s %s response: %s", c.Path, action, err)
+	}
+	return er.Data, nil
+}
+
+// Query builds the strapi query string for a collection request. Every value is url encoded, so a value
+// like a slack id can never add filters of its own. Field names come from code, not from callers.
+type Query struct {
+	filters  []Filter
+	sort     []string
+	fields   []string
+	populate []string
+	page     int
+	pageSize int
+}
+
+// NewQuery starts an empty query
+func NewQuery() *Query {
+	return &Query{}
+}
+
+// Where adds filters, all of them have to match
+func (q *Query) Where(filters ...Filter) *Query {
+	q.filters = append(q.filters, filters...)
+	return q
+}
+
+// Sort orders by fields like "id:asc" or "updatedAt:desc"
+func (q *Query) Sort(fields ...string) *Query {
+	q.sort = append(q.sort, fields...)
+	return q
+}
+
+// Fields limits the attributes strapi returns
+func (q *Query) Fields(fields ...string) *Query {
+	q.fields = append(q.fields, fields...)
+	return q
+}
+
+// Populate includes relations, "*" populates every relation one level deep
+func (q *Query) Populate(relations ...string) *Query {
+	q.populate = append(q.populate, relations...)
+	return q
+}
+
+// Page asks for one page of results, pages start at 1
+func (q *Query) Page(page int, pageSize int) *Query {
+	q.page = page
+	q.pageSize = pageSize
+	return q
+}
+
+// Values returns the query in strapi's bracket notation
+func (q *Query) Values() url.Values {
+	v := url.Values{}
+	if len(q.filters) == 1 {
+		q.filters[0].encode(v, "filters")
+	} else if len(q.filters) > 1 {
+		And(q.filters...).encode(v, "filters")
+	}
+	for i, s := range q.sort {
+		v.Set("sort["+strconv.Itoa(i)+"]", s)
+	}
+	for i, f := range q.fields {
+		v.Set("fields["+strconv.Itoa(i)+"]", f)
+	}
+	if len(q.populate) == 1 && q.populate[0] == "*" {
+		v.Set("populate", "*")
+	} else {
+		for i, p := range q.populate {
+			v.Set("populate["+strconv.Itoa(i)+"]", p)
+		}
+	}
+	if q.page > 0 {
+		v.Set("pagination[page]", strconv.Itoa(q.page))
+	}
+	if q.pageSize > 0 {
+		v.Set("pagination[pageSize]", strconv.Itoa(q.pageSize))
+	}
+	return v
+}
+
+// Encode returns the url encoded query string
+func (q *Query) Encode() string {
+	return q.Values().Encode()
+}
+
+// Filter is one condition of a query, build them with Eq, In, Contains and friends
+type Filter struct {
+	field  string
+	op     string
+	values []string
+	// group is set for $and and $or
+	group []Filter
+}
+
+// Eq matches entities whose field equals value
+func Eq(field string, value string) Filter {
+	return Filter{field: field, op: "$eq", values: []string{value}}
+}
+
+// EqI matches entities whose field equals value, ignoring case
+func EqI(field string, value string) Filter {
+	return Filter{field: field, op: "$eqi", values: []string{value}}
+}
+
+// In matches entities whose field is one of values
+func In(field string, values ...string) Filter {
+	return Filter{field: field, op: "$in", values: values}
+}
+
+// Contains matches entities whose field contains value, case sensitive
+func Contains(field string, value string) Filter {
+	return Filter{field: field, op: "$contains", values: []string{value}}
+}
+
+// ContainsI matches entities whose field contains value, ignoring case
+func ContainsI(field string, value string) Filter {
+	return Filter{field: field, op: "$containsi", values: []string{value}}
+}
+
+// Lt matches entities whose field is less than value
+func Lt(field string, value string) Filter {
+	return Filter{field: field, op: "$lt", values: []string{value}}
+}
+
+// Gte matches entities whose field is at least value
+func Gte(field string, value string) Filter {
+	return Filter{field: field, op: "$gte", values: []string{value}}
+}
+
+// Null matches entities whose field isn't set
+func Null(field string) Filter {
+	return Filter{field: field, op: "$null", values: []string{"true"}}
+}
+
+// And matches entities that match every filter
+func And(filters ...Filter) Filter {
+	return Filter{op: "$and", group: filters}
+}
+
+// Or matches entities that match any of the filters
+func Or(filters ...Filter) Filter {
+	return Filter{op: "$or", group: filters}
+}
+
+func (f Filter) encode(v url.Values, prefix string) {
+	if f.group != nil {
+		for i, g := range f.group {
+			g.encode(v, prefix+"["+f.op+"]["+strconv.Itoa(i)+"]")
+		}
+		return
+	}
+	// Relations are filtered with dotted names, e.g. person.slack_id
+	key := prefix + "[" + strings.ReplaceAll(f.field, ".", "][") + "][" + f.op + "]"
+	if f.op == "$in" {
+		for i, value := range f.values {
+			v.Set(key+"["+strconv.Itoa(i)+"]", value)
+		}
+		return
+	}
+	v.Set(key, f.values[0])
+}
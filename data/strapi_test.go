@@ -0,0 +1,65 @@
+package data
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestQueryEncodesValues(t *testing.T) {
+	// A slack id that tries to sneak in a filter of its own
+	slackID := "U1&filters[tenant][$null]=false"
+	q := NewQuery().Where(Eq("slack_id", slackID)).Sort("id:asc")
+
+	got, err := url.ParseQuery(q.Encode())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := url.Values{
+		"filters[slack_id][$eq]": {slackID},
+		"sort[0]":                {"id:asc"},
+	}
+	if got.Encode() != want.Encode() {
+		t.Errorf("query decoded to %v, expected %v", got, want)
+	}
+}
+
+func TestQueryFilterGroups(t *testing.T) {
+	q := NewQuery().Where(
+		Null("tenant"),
+		Or(Contains("display_name", "pete"), In("meetup_id", "1", "2")),
+	)
+
+	want := url.Values{
+		"filters[$and][0][tenant][$null]":                   {"true"},
+		"filters[$and][1][$or][0][display_name][$contains]": {"pete"},
+		"filters[$and][1][$or][1][meetup_id][$in][0]":       {"1"},
+		"filters[$and][1][$or][1][meetup_id][$in][1]":       {"2"},
+	}
+	if got := q.Values(); got.Encode() != want.Encode() {
+		t.Errorf("q.Values() = %v, expected %v", got, want)
+	}
+}
+
+func TestQueryFieldsPopulateAndPagination(t *testing.T) {
+	q := NewQuery().
+		Where(Eq("person.slack_id", "UC81JHDJ6")).
+		Fields("title", "url").
+		Populate("person").
+		Page(2, 50)
+
+	want := url.Values{
+		"filters[person][slack_id][$eq]": {"UC81JHDJ6"},
+		"fields[0]":                      {"title"},
+		"fields[1]":                      {"url"},
+		"populate[0]":                    {"person"},
+		"pagination[page]":               {"2"},
+		"pagination[pageSize]":           {"50"},
+	}
+	if got := q.Values(); got.Encode() != want.Encode() {
+		t.Errorf("q.Values() = %v, expected %v", got, want)
+	}
+
+	if got := NewQuery().Populate("*").Encode(); got != "populate=%2A" {
+		t.Errorf("populate all encoded as %q", got)
+	}
+}
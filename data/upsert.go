@@ -0,0 +1,81 @@
+package data
+
+import (
+	"context"
+	"fmt"
+)
+
+// Upserts for the same slack id are serialized so a new member firing two shortcuts only gets one person
+var personUpsertLocks keyedMutex
+
+// UpsertPersonBySlackID creates the person for a slack id or applies the update to the existing one,
+// always returning the single canonical record for that slack id. The update's tenant picks the workspace.
+// encore:api private method=PUT path=/data/users/:slackID
+func UpsertPersonBySlackID(ctx context.Context, slackID string, p *PersonUpdate) (*Person, error) {
+	return upsertPersonBySlackID(ctx, apiPersonStore{}, slackID, p)
+}
+
+// personStore is the part of the Forge Data API the upsert needs
+type personStore interface {
+	FindBySlackID(ctx context.Context, slackID string, tenant string) ([]*Person, error)
+	Create(ctx context.Context, p *PersonUpdate) (*Person, error)
+	Update(ctx context.Context, id int, p *PersonUpdate) (*Person, error)
+	Delete(ctx context.Context, id int) error
+}
+
+func upsertPersonBySlackID(ctx context.Context, store personStore, slackID string, p *PersonUpdate) (*Person, error) {
+	tenant := ""
+	if p.Tenant != nil {
+		tenant = *p.Tenant
+	}
+	unlock := personUpsertLocks.Lock(tenant + "/" + slackID)
+	defer unlock()
+
+	people, err := store.FindBySlackID(ctx, slackID, tenant)
+	if err != nil {
+		return nil, err
+	}
+	if len(people) > 0 {
+		return store.Update(ctx, people[0].ID, p)
+	}
+
+	create := *p
+	create.SlackID = &slackID
+	created, err := store.Create(ctx, &create)
+	if err != nil {
+		return nil, err
+	}
+
+	// Another instance may have created the same person while we did, the oldest record wins
+	people, err = store.FindBySlackID(ctx, slackID, tenant)
+	if err != nil {
+		return nil, err
+	}
+	if len(people) == 0 || people[0].ID == created.ID {
+		return created, nil
+	}
+	if err := store.Delete(ctx, created.ID); err != nil {
+		return nil, fmt.Errorf("removing duplicate person %d: %w", created.ID, err)
+	}
+	// Our changes only made it onto the record we just removed
+	return store.Update(ctx, people[0].ID, p)
+}
+
+// apiPersonStore is the personStore backed by the Forge Data API
+type apiPersonStore struct{}
+
+func (apiPersonStore) FindBySlackID(ctx context.Context, slackID string, tenant string) ([]*Person, error) {
+	return findPeopleBySlackID(ctx, slackID, tenant)
+}
+
+func (apiPersonStore) Create(ctx context.Context, p *PersonUpdate) (*Person, error) {
+	return createPerson(ctx, p)
+}
+
+func (apiPersonStore) Update(ctx context.Context, id int, p *PersonUpdate) (*Person, error) {
+	return UpdatePerson(ctx, id, p)
+}
+
+func (apiPersonStore) Delete(ctx context.Context, id int) error {
+	return deletePerson(ctx, id)
+}
@@ -0,0 +1,192 @@
+package data
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakePersonStore is an in-memory Forge Data API. Every call yields so unserialized upserts would interleave.
+type fakePersonStore struct {
+	mu      sync.Mutex
+	nextID  int
+	people  map[int]*Person
+	creates int
+	// beforeCreate runs before a create is stored, used to simulate another instance writing first
+	beforeCreate func(s *fakePersonStore)
+}
+
+func newFakePersonStore() *fakePersonStore {
+	return &fakePersonStore{nextID: 1, people: map[int]*Person{}}
+}
+
+func (s *fakePersonStore) insert(slackID string) *Person {
+	return s.insertInTenant(slackID, "")
+}
+
+func (s *fakePersonStore) insertInTenant(slackID string, tenant string) *Person {
+	p := &Person{ID: s.nextID}
+	p.Attributes.SlackID = slackID
+	p.Attributes.Tenant = tenant
+	s.people[p.ID] = p
+	s.nextID++
+	return p
+}
+
+func (s *fakePersonStore) FindBySlackID(ctx context.Context, slackID string, tenant string) ([]*Person, error) {
+	time.Sleep(time.Millisecond)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var found []*Person
+	for _, p := range s.people {
+		if p.Attributes.SlackID == slackID && p.Attributes.Tenant == tenant {
+			found = append(found, p)
+		}
+	}
+	sort.Slice(found, func(i, j int) bool { return found[i].ID < found[j].ID })
+	return found, nil
+}
+
+func (s *fakePersonStore) Create(ctx context.Context, u *PersonUpdate) (*Person, error) {
+	time.Sleep(time.Millisecond)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.beforeCreate != nil {
+		s.beforeCreate(s)
+	}
+	s.creates++
+	tenant := ""
+	if u.Tenant != nil {
+		tenant = *u.Tenant
+	}
+	p := s.insertInTenant(*u.SlackID, tenant)
+	if u.DisplayName != nil {
+		p.Attributes.DisplayName = *u.DisplayName
+	}
+	if u.Email != nil {
+		p.Attributes.Email = *u.Email
+	}
+	return p, nil
+}
+
+func (s *fakePersonStore) Update(ctx context.Context, id int, u *PersonUpdate) (*Person, error) {
+	time.Sleep(time.Millisecond)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p := s.people[id]
+	if u.DisplayName != nil {
+		p.Attributes.DisplayName = *u.DisplayName
+	}
+	if u.Email != nil {
+		p.Attributes.Email = *u.Email
+	}
+	return p, nil
+}
+
+func (s *fakePersonStore) Delete(ctx context.Context, id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.people, id)
+	return nil
+}
+
+func TestUpsertPersonBySlackIDParallel(t *testing.T) {
+	const syncs = 50
+	store := newFakePersonStore()
+	name := "clint"
+
+	var wg sync.WaitGroup
+	ids := make([]int, syncs)
+	errors := make([]error, syncs)
+	for i := 0; i < syncs; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			p, err := upsertPersonBySlackID(context.Background(), store, "UC81JHDJ6", &PersonUpdate{DisplayName: &name})
+			errors[i] = err
+			if err == nil {
+				ids[i] = p.ID
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	for i, err := range errors {
+		if err != nil {
+			t.Fatalf("upsert %d: %v", i, err)
+		}
+		if ids[i] != ids[0] {
+			t.Errorf("upsert %d returned person %d, expected %d", i, ids[i], ids[0])
+		}
+	}
+	if len(store.people) != 1 || store.creates != 1 {
+		t.Errorf("store has %d people from %d creates after %d parallel syncs, expected 1", len(store.people), store.creates, syncs)
+	}
+}
+
+func TestUpsertPersonBySlackIDLosesCreateRace(t *testing.T) {
+	store := newFakePersonStore()
+	var winner *Person
+	store.beforeCreate = func(s *fakePersonStore) {
+		winner = s.insert("UC81JHDJ6")
+	}
+
+	name := "clint"
+	email := "clint@example.com"
+	p, err := upsertPersonBySlackID(context.Background(), store, "UC81JHDJ6", &PersonUpdate{DisplayName: &name, Email: &email})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.ID != winner.ID {
+		t.Errorf("upsert returned person %d, expected the existing person %d", p.ID, winner.ID)
+	}
+	if stored := store.people[winner.ID]; stored.Attributes.DisplayName != name || stored.Attributes.Email != email {
+		t.Errorf("winner = %+v, expected the update to be applied to it", stored.Attributes)
+	}
+	if len(store.people) != 1 {
+		t.Errorf("store has %d people, expected the duplicate to be removed", len(store.people))
+	}
+}
+
+func TestUpsertPersonBySlackIDUsesOldestDuplicate(t *testing.T) {
+	store := newFakePersonStore()
+	oldest := store.insert("UC81JHDJ6")
+	store.insert("UC81JHDJ6")
+	name := "clint"
+
+	p, err := upsertPersonBySlackID(context.Background(), store, "UC81JHDJ6", &PersonUpdate{DisplayName: &name})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.ID != oldest.ID || p.Attributes.DisplayName != name {
+		t.Errorf("upsert = %+v, expected person %d updated to %q", p, oldest.ID, name)
+	}
+}
+
+func TestUpsertPersonBySlackIDScopedByTenant(t *testing.T) {
+	store := newFakePersonStore()
+	forge := store.insert("UC81JHDJ6")
+	other := "T0OTHER"
+
+	p, err := upsertPersonBySlackID(context.Background(), store, "UC81JHDJ6", &PersonUpdate{Tenant: &other})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.ID == forge.ID || p.Attributes.Tenant != other {
+		t.Fatalf("upsert = %+v, expected a new person in %s", p, other)
+	}
+
+	name := "clint"
+	p, err = upsertPersonBySlackID(context.Background(), store, "UC81JHDJ6", &PersonUpdate{DisplayName: &name})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.ID != forge.ID {
+		t.Errorf("upsert without a tenant updated person %d, expected the original workspace's person %d", p.ID, forge.ID)
+	}
+	if len(store.people) != 2 {
+		t.Errorf("store has %d people, expected one per workspace", len(store.people))
+	}
+}
@@ -0,0 +1,94 @@
+package data
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"encore.dev/beta/errs"
+	"encore.dev/rlog"
+)
+
+// Strapi entry events the person webhook acts on
+const (
+	strapiEntryCreate    = "entry.create"
+	strapiEntryUpdate    = "entry.update"
+	strapiEntryDelete    = "entry.delete"
+	strapiEntryPublish   = "entry.publish"
+	strapiEntryUnpublish = "entry.unpublish"
+)
+
+// strapiPersonModel is the model name strapi sends for the people collection
+const strapiPersonModel = "person"
+
+// StrapiEntryEvent is the body of a Forge Data API webhook
+type StrapiEntryEvent struct {
+	Event string `json:"event"`
+	Model string `json:"model"`
+	Entry struct {
+		ID int `json:"id"`
+	} `json:"entry"`
+}
+
+// DataAPIWebhook handles the Forge Data API's entry webhooks so people changed by other forge apps, or by hand in
+// the strapi admin, don't wait for the next mirror sync or the cache to expire.
+//
+//encore:api public raw method=POST path=/data/webhooks/strapi
+func DataAPIWebhook(w http.ResponseWriter, r *http.Request) {
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if secrets.DataAPIWebhookToken == "" || subtle.ConstantTimeCompare([]byte(token), []byte(secrets.DataAPIWebhookToken)) != 1 {
+		rlog.Error("Rejected data api webhook")
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		rlog.Error("Error reading data api webhook body", "err", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	event := StrapiEntryEvent{}
+	err = json.Unmarshal(body, &event)
+	if err != nil {
+		rlog.Error("Error decoding data api webhook", "err", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	rlog.Debug("data api webhook", "event", event.Event, "model", event.Model, "id", event.Entry.ID)
+	if event.Model != strapiPersonModel || event.Entry.ID == 0 {
+		return
+	}
+	if err := personChanged(r.Context(), event.Event, event.Entry.ID); err != nil {
+		rlog.Error("Error handling person webhook", "event", event.Event, "id", event.Entry.ID, "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+// personChanged refreshes the mirror and the cache for a person the api says changed. The webhook's entry is
+// strapi's internal shape, so the person is loaded the way the rest of the service sees them.
+func personChanged(ctx context.Context, event string, id int) error {
+	switch event {
+	case strapiEntryCreate, strapiEntryUpdate, strapiEntryPublish, strapiEntryUnpublish:
+		p, err := people.Get(ctx, id, nil)
+		// Unpublished or already deleted people are gone as far as the api's readers are concerned
+		if e, ok := err.(*errs.Error); ok && e.Code == errs.NotFound {
+			return forgetPerson(ctx, id)
+		}
+		if err != nil {
+			return err
+		}
+		personWritten(ctx, p)
+	case strapiEntryDelete:
+		return forgetPerson(ctx, id)
+	}
+	return nil
+}
+
+// forgetPerson drops a person the api no longer has from the mirror and the cache
+func forgetPerson(ctx context.Context, id int) error {
+	personLookups.invalidate(&Person{ID: id})
+	return deleteMirroredPerson(ctx, id)
+}
@@ -0,0 +1,36 @@
+// Package jobs declares the platform's recurring cron jobs so every schedule is in one place.
+package jobs
+
+import (
+	"encore.app/data"
+	"encore.app/slack"
+	"encore.dev/cron"
+)
+
+// Pick up members that joined or changed their profile without using a shortcut
+var _ = cron.NewJob("slack-member-sync", cron.JobConfig{
+	Title:    "Sync Slack workspace members to the Forge Data API",
+	Every:    24 * cron.Hour,
+	Endpoint: slack.SyncWorkspaceMembers,
+})
+
+// Nudge new members that still haven't finished their profile, mid morning Utah time
+var _ = cron.NewJob("onboarding-follow-up", cron.JobConfig{
+	Title:    "Follow up with new members that haven't finished onboarding",
+	Schedule: "0 16 * * *",
+	Endpoint: slack.FollowUpOnboarding,
+})
+
+// Pull the people other forge apps changed into the data service's mirror
+var _ = cron.NewJob("people-mirror-sync", cron.JobConfig{
+	Title:    "Sync changed people from the Forge Data API into the mirror",
+	Every:    5 * cron.Minute,
+	Endpoint: data.SyncPeopleMirror,
+})
+
+// Catch deletes and anything else the incremental pulls missed
+var _ = cron.NewJob("people-mirror-reconcile", cron.JobConfig{
+	Title:    "Reconcile the people mirror with the Forge Data API",
+	Every:    24 * cron.Hour,
+	Endpoint: data.ReconcilePeopleMirror,
+})
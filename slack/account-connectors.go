@@ -0,0 +1,51 @@
+package slack
+
+import (
+	"context"
+
+	"encore.app/data"
+)
+
+// AccountConnector is an outside account members can link to their forge profile through a kolla connector.
+// Connectors add themselves with registerConnector from an init func, nothing else needs to know about them.
+type AccountConnector struct {
+	// Key is the short name used in /forge link and button values, e.g. "github"
+	Key string
+	// Name is what members see, e.g. "GitHub"
+	Name string
+	// KollaConnector is the kolla connector id, e.g. "github-kolla"
+	KollaConnector string
+	// Enrich loads the linked account with its access token and returns the person fields to fill in
+	Enrich func(ctx context.Context, token string) (*data.PersonUpdate, error)
+	// Account is what the person record holds about the linked account, empty when nothing was filled in
+	Account func(p *data.Person) string
+	// Clear returns the update that empties the fields Enrich filled, used when the account is unlinked
+	Clear func() *data.PersonUpdate
+}
+
+// accountConnectors in the order they are offered to members
+var accountConnectors []*AccountConnector
+
+func registerConnector(c *AccountConnector) {
+	accountConnectors = append(accountConnectors, c)
+}
+
+// connectorByKey finds a connector by its short name, nil if there is none
+func connectorByKey(key string) *AccountConnector {
+	for _, c := range accountConnectors {
+		if c.Key == key {
+			return c
+		}
+	}
+	return nil
+}
+
+// connectorByKolla finds a connector by its kolla connector id, nil if there is none
+func connectorByKolla(kollaConnector string) *AccountConnector {
+	for _, c := range accountConnectors {
+		if c.KollaConnector == kollaConnector {
+			return c
+		}
+	}
+	return nil
+}
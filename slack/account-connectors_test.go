@@ -0,0 +1,30 @@
+package slack
+
+import "testing"
+
+func TestAccountConnectorsRegistered(t *testing.T) {
+	keys := map[string]bool{}
+	kollaConnectors := map[string]bool{}
+	for _, c := range accountConnectors {
+		if c.Key == "" || c.Name == "" || c.KollaConnector == "" {
+			t.Errorf("connector %+v is missing its key, name or kolla connector", c)
+		}
+		if c.Enrich == nil || c.Account == nil || c.Clear == nil {
+			t.Errorf("connector %s is missing a hook", c.Key)
+		}
+		if keys[c.Key] || kollaConnectors[c.KollaConnector] {
+			t.Errorf("connector %s is registered twice", c.Key)
+		}
+		keys[c.Key] = true
+		kollaConnectors[c.KollaConnector] = true
+
+		if connectorByKey(c.Key) != c || connectorByKolla(c.KollaConnector) != c {
+			t.Errorf("connector %s can't be looked up", c.Key)
+		}
+	}
+	for _, key := range []string{"meetup", "github", "linkedin"} {
+		if !keys[key] {
+			t.Errorf("%s connector isn't registered", key)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package slack
+
+import (
+	"context"
+
+	"encore.dev/rlog"
+)
+
+// PublishAppHome renders the App Home tab for a slack user
+func PublishAppHome(ctx context.Context, slackID string) error {
+	view, err := renderJSON("app_home", tmplAppHome, nil)
+	if err != nil {
+		rlog.Error("Error rendering App Home", "err", err)
+		return err
+	}
+
+	err = slackClient.ViewsPublish(ctx, slackID, view)
+	if err != nil {
+		rlog.Error("Error publishing App Home", "err", err)
+		return err
+	}
+
+	return nil
+}
+
+// App Home tab view
+const tmplAppHome = `{
+    "type": "home",
+    "blocks": [
+        {
+            "type": "section",
+            "text": {
+                "type": "mrkdwn",
+                "text": "*Welcome to Forge Utah!*"
+            }
+        },
+        {
+            "type": "divider"
+        },
+        {
+            "type": "section",
+            "text": {
+                "type": "mrkdwn",
+                "text": "Let the community know who you are by filling out your Forge profile."
+            },
+            "accessory": {
+                "type": "button",
+                "action_id": "edit_profile",
+                "text": {
+                    "type": "plain_text",
+                    "text": "Edit my Forge profile",
+                    "emoji": true
+                }
+            }
+        }
+    ]
+}`
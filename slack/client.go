@@ -3,64 +3,404 @@ package slack
 import (
 	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
-	"log"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
 
 	"encore.dev/rlog"
-	"github.com/kollalabs/sdk-go/kc"
 )
 
 const BaseURL = "https://slack.com/api/"
 
-func HttpRequest(ctx context.Context, method string, path string, body []byte) ([]byte, *http.Response, error) {
-	respBody := []byte{}
-	resp := &http.Response{}
+// SlackAPI is the part of the slack web api the service uses. Handlers call it through slackClient
+// so tests can swap in a fake.
+type SlackAPI interface {
+	ViewsOpen(ctx context.Context, triggerID string, view json.RawMessage) (*OpenedView, error)
+	ViewsUpdate(ctx context.Context, viewID string, hash string, view json.RawMessage) error
+	ViewsPublish(ctx context.Context, userID string, view json.RawMessage) error
+	ChatPostMessage(ctx context.Context, msg *Message) (*PostedMessage, error)
+	ChatUpdate(ctx context.Context, msg *Message) error
+	UsersInfo(ctx context.Context, userID string) (*SlackUser, error)
+	UsersList(ctx context.Context, cursor string) (*UsersListResponse, error)
+	UsersProfileGet(ctx context.Context, userID string) (SlackProfileFields, error)
+	ConversationsOpen(ctx context.Context, userIDs ...string) (string, error)
+	// UsergroupsUsersList returns the ids of a user group's members
+	UsergroupsUsersList(ctx context.Context, usergroupID string) ([]string, error)
+	// Respond sends a message to an interaction's response_url
+	Respond(ctx context.Context, responseURL string, msg *Message) error
+}
+
+// slackClient is what handlers use to talk to slack
+var slackClient SlackAPI = NewSlackClient(slackToken)
+
+// Message is a chat message, blocks are passed through as built by the message templates
+type Message struct {
+	Channel string          `json:"channel,omitempty"`
+	TS      string          `json:"ts,omitempty"`
+	Text    string          `json:"text"`
+	Blocks  json.RawMessage `json:"blocks,omitempty"`
+	// ResponseType and ReplaceOriginal only apply when responding to a response_url
+	ResponseType    string `json:"response_type,omitempty"`
+	ReplaceOriginal bool   `json:"replace_original,omitempty"`
+}
+
+// OpenedView identifies an open modal so it can be updated with views.update
+type OpenedView struct {
+	ID   string `json:"id"`
+	Hash string `json:"hash"`
+}
+
+// PostedMessage identifies a message so it can be updated later
+type PostedMessage struct {
+	Channel string `json:"channel"`
+	TS      string `json:"ts"`
+}
+
+type UsersListResponse struct {
+	Members          []SlackUser `json:"members"`
+	ResponseMetadata struct {
+		NextCursor string `json:"next_cursor"`
+	} `json:"response_metadata"`
+}
+
+// Errors slack api calls can be checked against with errors.Is
+var (
+	ErrUserNotFound    = errors.New("slack user not found")
+	ErrChannelNotFound = errors.New("slack channel not found")
+	ErrTriggerExpired  = errors.New("slack trigger id expired")
+	ErrNotAuthorized   = errors.New("slack token is not authorized")
+	ErrRateLimited     = errors.New("rate limited by slack")
+)
+
+// slackErrorKinds maps the error codes slack returns to the errors above
+var slackErrorKinds = map[string]error{
+	"user_not_found":     ErrUserNotFound,
+	"users_not_found":    ErrUserNotFound,
+	"channel_not_found":  ErrChannelNotFound,
+	"expired_trigger_id": ErrTriggerExpired,
+	"not_authed":         ErrNotAuthorized,
+	"invalid_auth":       ErrNotAuthorized,
+	"token_revoked":      ErrNotAuthorized,
+	"account_inactive":   ErrNotAuthorized,
+	"missing_scope":      ErrNotAuthorized,
+	"ratelimited":        ErrRateLimited,
+}
+
+// APIError is a slack api call that came back with ok:false or a bad status
+type APIError struct {
+	Method string
+	Code   string
+	// RetryAfter is how long slack asked us to wait when we were rate limited
+	RetryAfter time.Duration
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("slack %s failed: %s", e.Method, e.Code)
+}
+
+func (e *APIError) Is(target error) bool {
+	kind, ok := slackErrorKinds[e.Code]
+	return ok && kind == target
+}
 
-	kolla, err := kc.New(secrets.KollaAPIKey)
+// slackResponse is the envelope every slack api response has
+type slackResponse struct {
+	Ok      bool   `json:"ok"`
+	Error   string `json:"error"`
+	Warning string `json:"warning"`
+}
+
+// HTTPSlackClient calls the slack web api over http
+type HTTPSlackClient struct {
+	BaseURL string
+	Token   func(ctx context.Context) (string, error)
+	Client  *http.Client
+
+	limiter *rateLimiter
+}
+
+// NewSlackClient returns a client that authenticates with whatever token returns
+func NewSlackClient(token func(ctx context.Context) (string, error)) *HTTPSlackClient {
+	return &HTTPSlackClient{
+		BaseURL: BaseURL,
+		Token:   token,
+		Client:  &http.Client{Timeout: 30 * time.Second},
+		limiter: newRateLimiter(),
+	}
+}
+
+// call runs an api method within slack's rate limits. Background calls wait for the limit and are retried
+// after a 429, interactive calls fail fast with ErrRateLimited.
+func (c *HTTPSlackClient) call(ctx context.Context, method string, query url.Values, body interface{}, out interface{}) error {
+	for attempt := 1; ; attempt++ {
+		err := c.limiter.acquire(ctx, method)
+		if err != nil {
+			return err
+		}
+		err = c.do(ctx, method, query, body, out)
+		var apiErr *APIError
+		if !errors.As(err, &apiErr) || apiErr.Code != "ratelimited" {
+			return err
+		}
+		c.limiter.backoff(ctx, method, apiErr.RetryAfter)
+		if !isBackground(ctx) || attempt == rateLimitRetries {
+			return err
+		}
+	}
+}
+
+// do sends one request. Methods with a body are sent as a JSON POST, the rest as a GET with query.
+// The response is decoded into out once slack said ok.
+func (c *HTTPSlackClient) do(ctx context.Context, method string, query url.Values, body interface{}, out interface{}) error {
+	token, err := c.Token(ctx)
 	if err != nil {
-		rlog.Error("unable to load kolla connect client", "error", err)
-		return respBody, resp, err
+		return fmt.Errorf("couldn't load slack credentials: %w", err)
+	}
+
+	var req *http.Request
+	if body != nil {
+		reqBody, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		req, err = http.NewRequestWithContext(ctx, "POST", c.BaseURL+method, bytes.NewReader(reqBody))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	} else {
+		u := c.BaseURL + method
+		if len(query) > 0 {
+			u += "?" + query.Encode()
+		}
+		req, err = http.NewRequestWithContext(ctx, "GET", u, nil)
+		if err != nil {
+			return err
+		}
 	}
-	// Get consumer token
-	creds, err := kolla.Credentials(ctx, "internal-slack", "internal") // Use consumer ID set in consumer token
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := c.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	respBody, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
-		log.Fatalf("unable to load consumer credentials: %s\n", err)
-		return respBody, resp, err
+		return err
 	}
 
-	rlog.Debug("Slack API Request", "method", method, "url", BaseURL+path, "body", string(body))
+	if resp.StatusCode == http.StatusTooManyRequests {
+		return &APIError{Method: method, Code: "ratelimited", RetryAfter: retryAfter(resp)}
+	}
+	if resp.StatusCode != http.StatusOK {
+		return &APIError{Method: method, Code: "http_" + strconv.Itoa(resp.StatusCode)}
+	}
 
-	r := bytes.NewReader(body)
-	req, err := http.NewRequest(method, BaseURL+path, r)
+	envelope := slackResponse{}
+	err = json.Unmarshal(respBody, &envelope)
 	if err != nil {
-		rlog.Error("Error creating slack api request", "err", err)
-		return respBody, resp, err
+		return fmt.Errorf("couldn't decode slack %s response: %w", method, err)
 	}
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+creds.Token)
+	if !envelope.Ok {
+		return &APIError{Method: method, Code: envelope.Error}
+	}
+	if out == nil {
+		return nil
+	}
+	return json.Unmarshal(respBody, out)
+}
+
+func (c *HTTPSlackClient) ViewsOpen(ctx context.Context, triggerID string, view json.RawMessage) (*OpenedView, error) {
+	opened := struct {
+		View OpenedView `json:"view"`
+	}{}
+	err := c.call(ctx, "views.open", nil, map[string]interface{}{"trigger_id": triggerID, "view": view}, &opened)
+	if err != nil {
+		return nil, err
+	}
+	return &opened.View, nil
+}
+
+func (c *HTTPSlackClient) ViewsUpdate(ctx context.Context, viewID string, hash string, view json.RawMessage) error {
+	body := map[string]interface{}{"view_id": viewID, "view": view}
+	if hash != "" {
+		body["hash"] = hash
+	}
+	return c.call(ctx, "views.update", nil, body, nil)
+}
 
-	client := &http.Client{}
-	resp, err = client.Do(req)
+func (c *HTTPSlackClient) ViewsPublish(ctx context.Context, userID string, view json.RawMessage) error {
+	return c.call(ctx, "views.publish", nil, map[string]interface{}{"user_id": userID, "view": view}, nil)
+}
 
+func (c *HTTPSlackClient) ChatPostMessage(ctx context.Context, msg *Message) (*PostedMessage, error) {
+	posted := &PostedMessage{}
+	err := c.call(ctx, "chat.postMessage", nil, msg, posted)
 	if err != nil {
-		rlog.Error("Error sending request to slack", "err", err)
-		return respBody, resp, err
+		return nil, err
 	}
+	return posted, nil
+}
 
-	// Get response body and parse to json
-	respBody, err = ioutil.ReadAll(resp.Body)
+func (c *HTTPSlackClient) ChatUpdate(ctx context.Context, msg *Message) error {
+	return c.call(ctx, "chat.update", nil, msg, nil)
+}
+
+func (c *HTTPSlackClient) UsersInfo(ctx context.Context, userID string) (*SlackUser, error) {
+	resp := struct {
+		User SlackUser `json:"user"`
+	}{}
+	err := c.call(ctx, "users.info", url.Values{"user": {userID}}, nil, &resp)
+	if err != nil {
+		return nil, err
+	}
+	return &resp.User, nil
+}
+
+func (c *HTTPSlackClient) UsersList(ctx context.Context, cursor string) (*UsersListResponse, error) {
+	query := url.Values{"limit": {"200"}}
+	if cursor != "" {
+		query.Set("cursor", cursor)
+	}
+	page := &UsersListResponse{}
+	err := c.call(ctx, "users.list", query, nil, page)
+	if err != nil {
+		return nil, err
+	}
+	return page, nil
+}
+
+func (c *HTTPSlackClient) UsersProfileGet(ctx context.Context, userID string) (SlackProfileFields, error) {
+	resp := struct {
+		Profile struct {
+			Fields SlackProfileFields `json:"fields"`
+		} `json:"profile"`
+	}{}
+	err := c.call(ctx, "users.profile.get", url.Values{"user": {userID}}, nil, &resp)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Profile.Fields == nil {
+		return SlackProfileFields{}, nil
+	}
+	return resp.Profile.Fields, nil
+}
+
+func (c *HTTPSlackClient) ConversationsOpen(ctx context.Context, userIDs ...string) (string, error) {
+	resp := struct {
+		Channel struct {
+			ID string `json:"id"`
+		} `json:"channel"`
+	}{}
+	err := c.call(ctx, "conversations.open", nil, map[string]string{"users": strings.Join(userIDs, ",")}, &resp)
+	if err != nil {
+		return "", err
+	}
+	return resp.Channel.ID, nil
+}
+
+// UsergroupsUsersList returns the ids of a user group's members
+func (c *HTTPSlackClient) UsergroupsUsersList(ctx context.Context, usergroupID string) ([]string, error) {
+	resp := struct {
+		Users []string `json:"users"`
+	}{}
+	err := c.call(ctx, "usergroups.users.list", url.Values{"usergroup": {usergroupID}}, nil, &resp)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Users, nil
+}
+
+// Respond posts to a response_url, which answers with a plain "ok" rather than the usual envelope
+func (c *HTTPSlackClient) Respond(ctx context.Context, responseURL string, msg *Message) error {
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", responseURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+
+	resp, err := c.Client.Do(req)
 	if err != nil {
-		rlog.Error("Error reading slack api response", "err", err)
-		return respBody, resp, err
+		return err
 	}
-	rlog.Debug("Data API Response", "body", string(respBody))
-	// Check for error code
+	defer resp.Body.Close()
 	if resp.StatusCode != http.StatusOK {
-		rlog.Error("Error response from slack api", "status", resp.StatusCode, "body", string(respBody))
-		return respBody, resp, fmt.Errorf("Error response from slack api: %s", string(respBody))
+		respBody, _ := ioutil.ReadAll(resp.Body)
+		return &APIError{Method: "response_url", Code: string(respBody)}
+	}
+	return nil
+}
+
+// retryAfter is how long slack asked us to back off for after a 429
+func retryAfter(resp *http.Response) time.Duration {
+	seconds, err := strconv.Atoi(resp.Header.Get("Retry-After"))
+	if err != nil || seconds < 1 {
+		return time.Second
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// renderJSON executes a view or message template, templates get the json helper for escaping
+func renderJSON(name string, tmpl string, data interface{}) ([]byte, error) {
+	t, err := template.New(name).Funcs(template.FuncMap{"json": jsonString}).Parse(tmpl)
+	if err != nil {
+		return nil, err
+	}
+	var tpl bytes.Buffer
+	err = t.Execute(&tpl, data)
+	if err != nil {
+		return nil, err
 	}
+	return tpl.Bytes(), nil
+}
+
+// renderMessage executes a message template into a Message
+func renderMessage(name string, tmpl string, data interface{}) (*Message, error) {
+	b, err := renderJSON(name, tmpl, data)
+	if err != nil {
+		return nil, err
+	}
+	msg := &Message{}
+	err = json.Unmarshal(b, msg)
+	if err != nil {
+		return nil, fmt.Errorf("template %s didn't render a valid message: %w", name, err)
+	}
+	return msg, nil
+}
+
+// respondOrDM sends a message to an interaction's response_url, or as a DM when there isn't one.
+// The message's channel must be the member's id so the DM fallback knows where to go.
+func respondOrDM(ctx context.Context, responseURL string, msg *Message) error {
+	var err error
+	if responseURL != "" {
+		err = slackClient.Respond(ctx, responseURL, msg)
+	} else {
+		_, err = slackClient.ChatPostMessage(ctx, msg)
+	}
+	if err != nil {
+		rlog.Error("Error sending slack message", "err", err)
+	}
+	return err
+}
 
-	return respBody, resp, nil
+// respondOrDMText is respondOrDM for a plain text message only the member sees
+func respondOrDMText(ctx context.Context, slackID string, responseURL string, text string) error {
+	return respondOrDM(ctx, responseURL, &Message{
+		Channel:         slackID,
+		Text:            text,
+		ResponseType:    "ephemeral",
+		ReplaceOriginal: true,
+	})
 }
@@ -0,0 +1,195 @@
+package slack
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeSlack records what handlers send to slack
+type fakeSlack struct {
+	mu        sync.Mutex
+	users     map[string]*SlackUser
+	messages  []*Message
+	responses map[string][]*Message
+	views     map[string]json.RawMessage
+	// usergroups holds the member ids of each user group
+	usergroups map[string][]string
+}
+
+func newFakeSlack(t *testing.T) *fakeSlack {
+	f := &fakeSlack{
+		users:      map[string]*SlackUser{},
+		responses:  map[string][]*Message{},
+		views:      map[string]json.RawMessage{},
+		usergroups: map[string][]string{},
+	}
+	old := slackClient
+	slackClient = f
+	t.Cleanup(func() { slackClient = old })
+	return f
+}
+
+func (f *fakeSlack) ViewsOpen(ctx context.Context, triggerID string, view json.RawMessage) (*OpenedView, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.views[triggerID] = view
+	return &OpenedView{ID: "V-" + triggerID, Hash: "hash-" + triggerID}, nil
+}
+
+func (f *fakeSlack) ViewsUpdate(ctx context.Context, viewID string, hash string, view json.RawMessage) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.views[viewID] = view
+	return nil
+}
+
+func (f *fakeSlack) ViewsPublish(ctx context.Context, userID string, view json.RawMessage) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.views[userID] = view
+	return nil
+}
+
+func (f *fakeSlack) ChatPostMessage(ctx context.Context, msg *Message) (*PostedMessage, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.messages = append(f.messages, msg)
+	return &PostedMessage{Channel: msg.Channel, TS: "1"}, nil
+}
+
+func (f *fakeSlack) ChatUpdate(ctx context.Context, msg *Message) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.messages = append(f.messages, msg)
+	return nil
+}
+
+func (f *fakeSlack) UsersInfo(ctx context.Context, userID string) (*SlackUser, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	u, ok := f.users[userID]
+	if !ok {
+		return nil, &APIError{Method: "users.info", Code: "user_not_found"}
+	}
+	return u, nil
+}
+
+func (f *fakeSlack) UsersList(ctx context.Context, cursor string) (*UsersListResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	page := &UsersListResponse{}
+	for _, u := range f.users {
+		page.Members = append(page.Members, *u)
+	}
+	return page, nil
+}
+
+func (f *fakeSlack) UsersProfileGet(ctx context.Context, userID string) (SlackProfileFields, error) {
+	u, err := f.UsersInfo(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return u.Profile.Fields, nil
+}
+
+func (f *fakeSlack) ConversationsOpen(ctx context.Context, userIDs ...string) (string, error) {
+	return "D" + userIDs[0], nil
+}
+
+func (f *fakeSlack) UsergroupsUsersList(ctx context.Context, usergroupID string) ([]string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.usergroups[usergroupID], nil
+}
+
+func (f *fakeSlack) Respond(ctx context.Context, responseURL string, msg *Message) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.responses[responseURL] = append(f.responses[responseURL], msg)
+	return nil
+}
+
+func testToken(ctx context.Context) (string, error) {
+	return "xoxb-test", nil
+}
+
+func TestSlackClientOkFalse(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/users.info" || r.URL.Query().Get("user") != "UNOBODY" {
+			t.Errorf("unexpected request %s", r.URL)
+		}
+		if r.Header.Get("Authorization") != "Bearer xoxb-test" {
+			t.Errorf("request wasn't authenticated with the token")
+		}
+		w.Write([]byte(`{"ok":false,"error":"user_not_found"}`))
+	}))
+	defer server.Close()
+	c := NewSlackClient(testToken)
+	c.BaseURL = server.URL + "/"
+
+	_, err := c.UsersInfo(context.Background(), "UNOBODY")
+	if !errors.Is(err, ErrUserNotFound) {
+		t.Fatalf("expected ErrUserNotFound for ok:false, got %v", err)
+	}
+}
+
+func TestSlackClientRateLimited(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "30")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+	c := NewSlackClient(testToken)
+	c.BaseURL = server.URL + "/"
+
+	_, err := c.UsersList(context.Background(), "")
+	var apiErr *APIError
+	if !errors.Is(err, ErrRateLimited) || !errors.As(err, &apiErr) || apiErr.RetryAfter != 30*time.Second {
+		t.Fatalf("expected a rate limit error asking for 30s, got %v", err)
+	}
+}
+
+func TestChooseAccountToLinkRespondsWithEveryConnector(t *testing.T) {
+	f := newFakeSlack(t)
+
+	err := ChooseAccountToLink(context.Background(), "UC81JHDJ6", "https://hooks.slack.test/respond")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(f.messages) != 0 || len(f.responses["https://hooks.slack.test/respond"]) != 1 {
+		t.Fatalf("expected a single response_url reply, got %d messages and %v", len(f.messages), f.responses)
+	}
+
+	msg := f.responses["https://hooks.slack.test/respond"][0]
+	blocks := []struct {
+		Elements []struct {
+			Value string `json:"value"`
+		} `json:"elements"`
+	}{}
+	if err := json.Unmarshal(msg.Blocks, &blocks); err != nil {
+		t.Fatal(err)
+	}
+	if len(blocks) != 2 || len(blocks[1].Elements) != len(accountConnectors) {
+		t.Fatalf("expected a button per connector, got %s", msg.Blocks)
+	}
+	for i, c := range accountConnectors {
+		if blocks[1].Elements[i].Value != c.Key {
+			t.Errorf("button %d links %q, expected %q", i, blocks[1].Elements[i].Value, c.Key)
+		}
+	}
+
+	// Without a response_url the chooser is sent as a DM
+	err = ChooseAccountToLink(context.Background(), "UC81JHDJ6", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(f.messages) != 1 || f.messages[0].Channel != "UC81JHDJ6" {
+		t.Fatalf("expected a DM to the member, got %+v", f.messages)
+	}
+}
@@ -0,0 +1,75 @@
+package slack
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"encore.dev/rlog"
+)
+
+const forgeCommandHelp = "Here's what `/forge` can do:\n• `/forge link` links an account like Meetup or GitHub to your Forge profile\n• `/forge link <account>` shows whether that account is linked and lets you relink or unlink it\n• `/forge privacy export` DMs you everything Forge holds about you\n• `/forge privacy delete` erases your Forge data\n• `/forge sync` syncs every workspace member to Forge, organizers only"
+
+//encore:api public raw method=POST path=/slack/commands
+func CommandsRouter(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if _, ok := readSignedSlackRequest(w, r); !ok {
+		return
+	}
+	r.ParseForm()
+	command := r.PostFormValue("command")
+	userID := r.PostFormValue("user_id")
+	responseURL := r.PostFormValue("response_url")
+	args := strings.Fields(r.PostFormValue("text"))
+	rlog.Debug("slash command", "command", command, "user", userID, "args", args)
+
+	if command != "/forge" {
+		return
+	}
+	ws, ok := workspaceByTeam(r.PostFormValue("team_id"))
+	if !ok {
+		rlog.Info("Ignoring command from unknown workspace", "team", r.PostFormValue("team_id"))
+		return
+	}
+	ctx = withWorkspace(ctx, ws)
+	subcommand := ""
+	if len(args) > 0 {
+		subcommand = strings.ToLower(args[0])
+	}
+
+	// Slack wants an answer within 3 seconds, so reply with an empty 200 and do the work after
+	switch subcommand {
+	case "link":
+		if len(args) < 2 {
+			go ChooseAccountToLink(ctx, userID, responseURL)
+			return
+		}
+		c := connectorByKey(strings.ToLower(args[1]))
+		if c == nil {
+			go respondOrDMText(ctx, userID, responseURL, "I don't know how to link "+args[1]+". "+forgeCommandHelp)
+			return
+		}
+		go ShowLinkStatus(ctx, c, userID, responseURL)
+	case "privacy":
+		action := ""
+		if len(args) > 1 {
+			action = strings.ToLower(args[1])
+		}
+		switch action {
+		case "export":
+			go ExportPrivacyData(ctx, userID, responseURL)
+		case "delete":
+			go ConfirmPrivacyDelete(ctx, userID, responseURL)
+		default:
+			go respondOrDMText(ctx, userID, responseURL, forgeCommandHelp)
+		}
+	case "sync":
+		go SyncMembersCommand(ctx, userID, responseURL)
+	default:
+		go respondOrDMText(ctx, userID, responseURL, forgeCommandHelp)
+	}
+}
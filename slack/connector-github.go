@@ -0,0 +1,50 @@
+package slack
+
+import (
+	"context"
+	"fmt"
+
+	"encore.app/data"
+)
+
+func init() {
+	registerConnector(&AccountConnector{
+		Key:            "github",
+		Name:           "GitHub",
+		KollaConnector: "github-kolla",
+		Enrich: func(ctx context.Context, token string) (*data.PersonUpdate, error) {
+			login, err := loadGithubLogin(ctx, token)
+			if err != nil {
+				return nil, err
+			}
+			login = normalizeHandle(login)
+			return &data.PersonUpdate{GithubUser: &login}, nil
+		},
+		Account: func(p *data.Person) string {
+			if p.Attributes.GithubUser == "" {
+				return ""
+			}
+			return "@" + p.Attributes.GithubUser
+		},
+		Clear: func() *data.PersonUpdate {
+			cleared := ""
+			return &data.PersonUpdate{GithubUser: &cleared}
+		},
+	})
+}
+
+// loadGithubLogin asks github for the username of the linked account
+func loadGithubLogin(ctx context.Context, token string) (string, error) {
+	user := struct {
+		Login string `json:"login"`
+	}{}
+	headers := map[string]string{"Accept": "application/vnd.github+json"}
+	err := callJSON(ctx, "github api", "GET", "https://api.github.com/user", token, headers, nil, &user)
+	if err != nil {
+		return "", err
+	}
+	if user.Login == "" {
+		return "", fmt.Errorf("github api returned no user for the linked account")
+	}
+	return user.Login, nil
+}
@@ -0,0 +1,88 @@
+package slack
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kollalabs/sdk-go/kc/swagger"
+)
+
+// connectorHTTPClient is shared by the calls to kolla and the linked account apis so none of them can hang a handler
+var connectorHTTPClient = &http.Client{Timeout: 15 * time.Second}
+
+// callJSON sends body, if any, as json with token as the bearer token and decodes a 200 response into out.
+// api names the service in errors, e.g. "github api".
+func callJSON(ctx context.Context, api string, method string, url string, token string, headers map[string]string, body interface{}, out interface{}) error {
+	var reqBody io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reqBody = bytes.NewReader(b)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, url, reqBody)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := connectorHTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("Error response from %s: %d %s", api, resp.StatusCode, string(respBody))
+	}
+	if out == nil {
+		return nil
+	}
+	return json.Unmarshal(respBody, out)
+}
+
+var (
+	kollaConnectOnce sync.Once
+	kollaConnect     *swagger.APIClient
+)
+
+// kollaConnectAPI returns the sdk's connect api client for the calls kc.Client doesn't wrap
+func kollaConnectAPI() *swagger.ConnectApiService {
+	kollaConnectOnce.Do(func() {
+		cfg := swagger.NewConfiguration()
+		cfg.BasePath = "https://api.getkolla.com/connect"
+		cfg.HTTPClient = connectorHTTPClient
+		cfg.AddDefaultHeader("Authorization", "Bearer "+secrets.KollaAPIKey)
+		kollaConnect = swagger.NewAPIClient(cfg)
+	})
+	return kollaConnect.ConnectApi
+}
+
+// disableKollaLinkedAccount revokes a linked account, e.g. connectors/github-kolla/linkedaccounts/abc
+func disableKollaLinkedAccount(ctx context.Context, name string) error {
+	parts := strings.Split(name, "/")
+	if len(parts) != 4 || parts[0] != "connectors" || parts[2] != "linkedaccounts" {
+		return fmt.Errorf("unexpected linked account name %q", name)
+	}
+	_, _, err := kollaConnectAPI().ConnectDisableLinkedAccount(ctx, swagger.DisableLinkedAccountRequest{Name: name}, parts[1], parts[3])
+	return err
+}
@@ -0,0 +1,40 @@
+package slack
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCallJSON(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(`{"login":"octocat"}`))
+	}))
+	defer srv.Close()
+	ctx := context.Background()
+
+	user := struct {
+		Login string `json:"login"`
+	}{}
+	if err := callJSON(ctx, "github api", "GET", srv.URL, "token", nil, nil, &user); err != nil {
+		t.Fatal(err)
+	}
+	if user.Login != "octocat" {
+		t.Fatalf("expected the response to be decoded, got %q", user.Login)
+	}
+
+	if err := callJSON(ctx, "github api", "GET", srv.URL, "wrong", nil, nil, &user); err == nil {
+		t.Fatal("expected an error for a non 200 response")
+	}
+}
+
+func TestDisableLinkedAccountRejectsMalformedNames(t *testing.T) {
+	if err := disableKollaLinkedAccount(context.Background(), "github-kolla/abc"); err == nil {
+		t.Fatal("expected an error for a name that isn't connectors/{connector}/linkedaccounts/{id}")
+	}
+}
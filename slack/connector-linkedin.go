@@ -0,0 +1,45 @@
+package slack
+
+import (
+	"context"
+	"fmt"
+
+	"encore.app/data"
+)
+
+func init() {
+	registerConnector(&AccountConnector{
+		Key:            "linkedin",
+		Name:           "LinkedIn",
+		KollaConnector: "linkedin-kolla",
+		Enrich: func(ctx context.Context, token string) (*data.PersonUpdate, error) {
+			profileURL, err := loadLinkedinProfileURL(ctx, token)
+			if err != nil {
+				return nil, err
+			}
+			return &data.PersonUpdate{LinkedinURL: &profileURL}, nil
+		},
+		Account: func(p *data.Person) string {
+			return p.Attributes.LinkedinURL
+		},
+		Clear: func() *data.PersonUpdate {
+			cleared := ""
+			return &data.PersonUpdate{LinkedinURL: &cleared}
+		},
+	})
+}
+
+// loadLinkedinProfileURL builds the public profile url of the linked account from its vanity name
+func loadLinkedinProfileURL(ctx context.Context, token string) (string, error) {
+	me := struct {
+		VanityName string `json:"vanityName"`
+	}{}
+	err := callJSON(ctx, "linkedin api", "GET", "https://api.linkedin.com/v2/me?projection=(id,vanityName)", token, nil, nil, &me)
+	if err != nil {
+		return "", err
+	}
+	if me.VanityName == "" {
+		return "", fmt.Errorf("linkedin api returned no profile for the linked account")
+	}
+	return "https://www.linkedin.com/in/" + me.VanityName, nil
+}
@@ -0,0 +1,53 @@
+package slack
+
+import (
+	"context"
+	"fmt"
+
+	"encore.app/data"
+)
+
+func init() {
+	registerConnector(&AccountConnector{
+		Key:            "meetup",
+		Name:           "Meetup",
+		KollaConnector: "meetup-kolla",
+		Enrich: func(ctx context.Context, token string) (*data.PersonUpdate, error) {
+			meetupID, err := loadMeetupMemberID(ctx, token)
+			if err != nil {
+				return nil, err
+			}
+			return &data.PersonUpdate{MeetupID: &meetupID}, nil
+		},
+		Account: func(p *data.Person) string {
+			if p.Attributes.MeetupID == "" {
+				return ""
+			}
+			return "member " + p.Attributes.MeetupID
+		},
+		Clear: func() *data.PersonUpdate {
+			cleared := ""
+			return &data.PersonUpdate{MeetupID: &cleared}
+		},
+	})
+}
+
+// loadMeetupMemberID asks meetup who the linked account belongs to
+func loadMeetupMemberID(ctx context.Context, token string) (string, error) {
+	self := struct {
+		Data struct {
+			Self struct {
+				ID string `json:"id"`
+			} `json:"self"`
+		} `json:"data"`
+	}{}
+	query := map[string]string{"query": "query { self { id } }"}
+	err := callJSON(ctx, "meetup api", "POST", "https://api.meetup.com/gql", token, nil, query, &self)
+	if err != nil {
+		return "", err
+	}
+	if self.Data.Self.ID == "" {
+		return "", fmt.Errorf("meetup api returned no member for the linked account")
+	}
+	return self.Data.Self.ID, nil
+}
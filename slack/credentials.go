@@ -0,0 +1,250 @@
+package slack
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kollalabs/sdk-go/kc"
+	"github.com/kollalabs/sdk-go/kc/swagger"
+)
+
+// The kolla connector and consumer holding the original workspace's bot token, other workspaces name their
+// consumer in the SlackWorkspaces secret
+const (
+	internalSlackConnector = "internal-slack"
+	internalSlackConsumer  = "internal"
+)
+
+// Cached tokens are refreshed this long before they expire so a request never goes out with a dead token
+const credentialRefreshMargin = time.Minute
+
+// Tokens without an expiry are still refetched this often in case they were rotated in kolla
+const credentialMaxAge = time.Hour
+
+// A shared fetch gives up after this long so a hung kolla call can't block a key forever
+const credentialFetchTimeout = 10 * time.Second
+
+// Credential is an access token for a connector and consumer
+type Credential struct {
+	Token string
+	// ExpiresAt is zero when the token doesn't expire
+	ExpiresAt time.Time
+	// LinkedAccount is the kolla linked account resource name, e.g. connectors/github-kolla/linkedaccounts/abc
+	LinkedAccount string
+}
+
+// ErrNoLinkedAccount is returned for a consumer that hasn't linked an account for the connector
+var ErrNoLinkedAccount = errors.New("no linked account")
+
+// CredentialProvider hands out access tokens for kolla connectors
+type CredentialProvider interface {
+	Credentials(ctx context.Context, connector string, consumerID string) (*Credential, error)
+	// Forget drops anything cached for the consumer, e.g. after they linked or unlinked an account
+	Forget(connector string, consumerID string)
+}
+
+var (
+	credentialsOnce sync.Once
+	credentials     CredentialProvider
+)
+
+// credentialProvider returns the provider the service uses. Setting SlackBotToken skips kolla for the
+// original workspace's bot token, which is handy for local development. Other workspaces still get their
+// own bot token from kolla so their calls never go out as the forge bot.
+func credentialProvider() CredentialProvider {
+	credentialsOnce.Do(func() {
+		if credentials != nil {
+			return
+		}
+		kolla := NewKollaCredentialProvider(secrets.KollaAPIKey)
+		if secrets.SlackBotToken == "" {
+			credentials = kolla
+			return
+		}
+		credentials = &overrideCredentialProvider{
+			connector: internalSlackConnector,
+			consumer:  originalWorkspace().KollaConsumer,
+			override:  &StaticCredentialProvider{Token: secrets.SlackBotToken},
+			fallback:  kolla,
+		}
+	})
+	return credentials
+}
+
+// slackToken returns the bot token for calling the slack api in the workspace ctx acts on
+func slackToken(ctx context.Context) (string, error) {
+	cred, err := credentialProvider().Credentials(ctx, internalSlackConnector, workspaceFrom(ctx).KollaConsumer)
+	if err != nil {
+		return "", err
+	}
+	return cred.Token, nil
+}
+
+// NewKollaCredentialProvider loads credentials from kolla connect and caches them until they are about to expire
+func NewKollaCredentialProvider(apiKey string) CredentialProvider {
+	k := &kollaCredentials{apiKey: apiKey}
+	return newCachingCredentialProvider(k.fetch)
+}
+
+type kollaCredentials struct {
+	apiKey string
+	once   sync.Once
+	client *kc.Client
+	err    error
+}
+
+func (k *kollaCredentials) fetch(ctx context.Context, connector string, consumerID string) (*Credential, error) {
+	k.once.Do(func() {
+		k.client, k.err = kc.New(k.apiKey, func(cfg *swagger.Configuration) {
+			cfg.HTTPClient = connectorHTTPClient
+		})
+	})
+	if k.err != nil {
+		return nil, k.err
+	}
+	creds, err := k.client.Credentials(ctx, connector, consumerID)
+	if err != nil {
+		return nil, kollaCredentialsError(err)
+	}
+	cred := &Credential{Token: creds.Token, ExpiresAt: creds.ExpiryTime}
+	if creds.LinkedAccount != nil {
+		cred.LinkedAccount = creds.LinkedAccount.Name
+	}
+	return cred, nil
+}
+
+// kollaCredentialsError tells a consumer without a linked account apart from kolla or the network failing.
+// The sdk only passes on the response status, e.g. "404 Not Found".
+func kollaCredentialsError(err error) error {
+	var apiErr swagger.GenericSwaggerError
+	if errors.As(err, &apiErr) && strings.HasPrefix(apiErr.Error(), "404") {
+		return ErrNoLinkedAccount
+	}
+	return err
+}
+
+// cachingCredentialProvider caches what fetch returns per connector and consumer. Concurrent requests for a
+// token that isn't cached share a single fetch, and errors are never cached.
+type cachingCredentialProvider struct {
+	fetch func(ctx context.Context, connector string, consumerID string) (*Credential, error)
+	now   func() time.Time
+
+	mu       sync.Mutex
+	cache    map[string]*cachedCredential
+	inflight map[string]*credentialCall
+}
+
+type cachedCredential struct {
+	cred      *Credential
+	fetchedAt time.Time
+}
+
+type credentialCall struct {
+	done chan struct{}
+	cred *Credential
+	err  error
+}
+
+func newCachingCredentialProvider(fetch func(ctx context.Context, connector string, consumerID string) (*Credential, error)) *cachingCredentialProvider {
+	return &cachingCredentialProvider{
+		fetch:    fetch,
+		now:      time.Now,
+		cache:    map[string]*cachedCredential{},
+		inflight: map[string]*credentialCall{},
+	}
+}
+
+func (p *cachingCredentialProvider) Credentials(ctx context.Context, connector string, consumerID string) (*Credential, error) {
+	key := connector + "/" + consumerID
+
+	p.mu.Lock()
+	if c, ok := p.cache[key]; ok && p.fresh(c) {
+		p.mu.Unlock()
+		return c.cred, nil
+	}
+	call, ok := p.inflight[key]
+	if !ok {
+		call = &credentialCall{done: make(chan struct{})}
+		p.inflight[key] = call
+		go p.refresh(key, connector, consumerID, call)
+	}
+	p.mu.Unlock()
+
+	select {
+	case <-call.done:
+		return call.cred, call.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// refresh runs the fetch on behalf of everyone waiting on call. It doesn't use any caller's context
+// so one caller giving up doesn't fail the others, but it has its own deadline, and the in-flight
+// entry is cleared however the fetch ends so the next caller can try again.
+func (p *cachingCredentialProvider) refresh(key string, connector string, consumerID string, call *credentialCall) {
+	defer func() {
+		if r := recover(); r != nil {
+			call.cred, call.err = nil, fmt.Errorf("fetching %s credentials: %v", key, r)
+		}
+		p.mu.Lock()
+		if call.err == nil {
+			p.cache[key] = &cachedCredential{cred: call.cred, fetchedAt: p.now()}
+		}
+		delete(p.inflight, key)
+		p.mu.Unlock()
+		close(call.done)
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), credentialFetchTimeout)
+	defer cancel()
+	call.cred, call.err = p.fetch(ctx, connector, consumerID)
+}
+
+func (p *cachingCredentialProvider) fresh(c *cachedCredential) bool {
+	now := p.now()
+	if now.Sub(c.fetchedAt) >= credentialMaxAge {
+		return false
+	}
+	return c.cred.ExpiresAt.IsZero() || now.Add(credentialRefreshMargin).Before(c.cred.ExpiresAt)
+}
+
+func (p *cachingCredentialProvider) Forget(connector string, consumerID string) {
+	p.mu.Lock()
+	delete(p.cache, connector+"/"+consumerID)
+	p.mu.Unlock()
+}
+
+// StaticCredentialProvider hands out the same token for every connector, for local development and tests
+type StaticCredentialProvider struct {
+	Token string
+}
+
+func (p *StaticCredentialProvider) Credentials(ctx context.Context, connector string, consumerID string) (*Credential, error) {
+	return &Credential{Token: p.Token}, nil
+}
+
+func (p *StaticCredentialProvider) Forget(connector string, consumerID string) {}
+
+// overrideCredentialProvider uses override for one connector and consumer and fallback for the rest
+type overrideCredentialProvider struct {
+	connector string
+	consumer  string
+	override  CredentialProvider
+	fallback  CredentialProvider
+}
+
+func (p *overrideCredentialProvider) Credentials(ctx context.Context, connector string, consumerID string) (*Credential, error) {
+	if connector == p.connector && consumerID == p.consumer {
+		return p.override.Credentials(ctx, connector, consumerID)
+	}
+	return p.fallback.Credentials(ctx, connector, consumerID)
+}
+
+func (p *overrideCredentialProvider) Forget(connector string, consumerID string) {
+	p.override.Forget(connector, consumerID)
+	p.fallback.Forget(connector, consumerID)
+}
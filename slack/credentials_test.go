@@ -0,0 +1,166 @@
+package slack
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakeCredentials counts fetches and hands out tokens that expire after ttl
+type fakeCredentials struct {
+	fetches int32
+	ttl     time.Duration
+	now     func() time.Time
+	err     error
+}
+
+func (f *fakeCredentials) fetch(ctx context.Context, connector string, consumerID string) (*Credential, error) {
+	n := atomic.AddInt32(&f.fetches, 1)
+	time.Sleep(time.Millisecond)
+	if f.err != nil {
+		return nil, f.err
+	}
+	cred := &Credential{Token: connector + "-" + consumerID + "-" + strconv.Itoa(int(n))}
+	if f.ttl > 0 {
+		cred.ExpiresAt = f.now().Add(f.ttl)
+	}
+	return cred, nil
+}
+
+func TestCredentialsFetchedOnceForParallelCallers(t *testing.T) {
+	f := &fakeCredentials{ttl: time.Hour, now: time.Now}
+	p := newCachingCredentialProvider(f.fetch)
+
+	var wg sync.WaitGroup
+	tokens := make([]string, 50)
+	for i := range tokens {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			cred, err := p.Credentials(context.Background(), internalSlackConnector, internalSlackConsumer)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			tokens[i] = cred.Token
+		}(i)
+	}
+	wg.Wait()
+
+	if f.fetches != 1 {
+		t.Fatalf("expected a single fetch, got %d", f.fetches)
+	}
+	for _, token := range tokens {
+		if token != tokens[0] {
+			t.Fatalf("callers got different tokens %q and %q", tokens[0], token)
+		}
+	}
+}
+
+func TestCredentialsRefreshedBeforeExpiry(t *testing.T) {
+	now := time.Date(2023, 3, 1, 12, 0, 0, 0, time.UTC)
+	f := &fakeCredentials{ttl: 10 * time.Minute, now: func() time.Time { return now }}
+	p := newCachingCredentialProvider(f.fetch)
+	p.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	first, _ := p.Credentials(ctx, "github-kolla", "U1")
+	now = now.Add(5 * time.Minute)
+	cached, _ := p.Credentials(ctx, "github-kolla", "U1")
+	if cached.Token != first.Token || f.fetches != 1 {
+		t.Fatalf("expected the cached token halfway to expiry, got %q after %d fetches", cached.Token, f.fetches)
+	}
+
+	// Inside the refresh margin the token is treated as expired
+	now = now.Add(10*time.Minute - credentialRefreshMargin)
+	refreshed, _ := p.Credentials(ctx, "github-kolla", "U1")
+	if refreshed.Token == first.Token || f.fetches != 2 {
+		t.Fatalf("expected a refreshed token near expiry, got %q after %d fetches", refreshed.Token, f.fetches)
+	}
+}
+
+func TestCredentialsErrorsAreNotCached(t *testing.T) {
+	f := &fakeCredentials{now: time.Now, err: errors.New("kolla is down")}
+	p := newCachingCredentialProvider(f.fetch)
+	ctx := context.Background()
+
+	if _, err := p.Credentials(ctx, internalSlackConnector, internalSlackConsumer); err == nil {
+		t.Fatal("expected the fetch error")
+	}
+	f.err = nil
+	cred, err := p.Credentials(ctx, internalSlackConnector, internalSlackConsumer)
+	if err != nil || cred.Token == "" {
+		t.Fatalf("expected a token once kolla recovered, got %v", err)
+	}
+	if f.fetches != 2 {
+		t.Fatalf("expected the failed fetch to be retried, got %d fetches", f.fetches)
+	}
+}
+
+func TestCredentialsFetchHasADeadline(t *testing.T) {
+	p := newCachingCredentialProvider(func(ctx context.Context, connector string, consumerID string) (*Credential, error) {
+		if _, ok := ctx.Deadline(); !ok {
+			return nil, errors.New("fetch has no deadline")
+		}
+		return &Credential{Token: "token"}, nil
+	})
+
+	if _, err := p.Credentials(context.Background(), internalSlackConnector, internalSlackConsumer); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCredentialsFetchPanicClearsInflight(t *testing.T) {
+	panics := true
+	p := newCachingCredentialProvider(func(ctx context.Context, connector string, consumerID string) (*Credential, error) {
+		if panics {
+			panic("kolla client blew up")
+		}
+		return &Credential{Token: "token"}, nil
+	})
+	ctx := context.Background()
+
+	if _, err := p.Credentials(ctx, internalSlackConnector, internalSlackConsumer); err == nil {
+		t.Fatal("expected the panic to be returned as an error")
+	}
+	panics = false
+	if cred, err := p.Credentials(ctx, internalSlackConnector, internalSlackConsumer); err != nil || cred.Token != "token" {
+		t.Fatalf("expected a fresh fetch after the panic, got %v", err)
+	}
+}
+
+func TestCredentialsForget(t *testing.T) {
+	f := &fakeCredentials{now: time.Now}
+	p := newCachingCredentialProvider(f.fetch)
+	ctx := context.Background()
+
+	p.Credentials(ctx, "meetup-kolla", "U1")
+	p.Forget("meetup-kolla", "U1")
+	p.Credentials(ctx, "meetup-kolla", "U1")
+	if f.fetches != 2 {
+		t.Fatalf("expected a fetch after forgetting, got %d fetches", f.fetches)
+	}
+}
+
+func TestOverrideOnlyAppliesToOneConsumer(t *testing.T) {
+	f := &fakeCredentials{now: time.Now}
+	p := &overrideCredentialProvider{
+		connector: internalSlackConnector,
+		consumer:  internalSlackConsumer,
+		override:  &StaticCredentialProvider{Token: "xoxb-local"},
+		fallback:  newCachingCredentialProvider(f.fetch),
+	}
+
+	cred, err := p.Credentials(context.Background(), internalSlackConnector, internalSlackConsumer)
+	if err != nil || cred.Token != "xoxb-local" {
+		t.Errorf("expected the override for the original workspace, got %+v, %v", cred, err)
+	}
+	cred, err = p.Credentials(context.Background(), internalSlackConnector, "T0OTHER")
+	if err != nil || cred.Token == "xoxb-local" {
+		t.Errorf("expected another workspace to get its own token, got %+v, %v", cred, err)
+	}
+}
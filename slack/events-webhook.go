@@ -0,0 +1,54 @@
+package slack
+
+import (
+	"context"
+	"net/http"
+
+	"encore.dev/rlog"
+	"github.com/tidwall/gjson"
+)
+
+//encore:api public raw method=POST path=/slack/events
+func EventsRouter(w http.ResponseWriter, r *http.Request) {
+	// Nobody is waiting on these in slack, so slack calls can queue for the rate limit
+	ctx := withBackgroundPriority(context.Background())
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	body, ok := readSignedSlackRequest(w, r)
+	if !ok {
+		return
+	}
+	payload := string(body)
+	rlog.Debug("slack event", "payload", payload)
+
+	switch gjson.Get(payload, "type").String() {
+	case "url_verification":
+		// Slack checks the endpoint by asking us to echo the challenge back
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte(gjson.Get(payload, "challenge").String()))
+		return
+	case "event_callback":
+		ws, ok := workspaceByTeam(gjson.Get(payload, "team_id").String())
+		if !ok {
+			rlog.Info("Ignoring event from unknown workspace", "team", gjson.Get(payload, "team_id").String())
+			return
+		}
+		ctx = withWorkspace(ctx, ws)
+		eventType := gjson.Get(payload, "event.type")
+		// switch statement to handle different types of slack events
+		switch eventType.String() {
+		case "app_home_opened":
+			if gjson.Get(payload, "event.tab").String() != "home" {
+				return
+			}
+			userID := gjson.Get(payload, "event.user").String()
+			go PublishAppHome(ctx, userID)
+		case "team_join":
+			go HandleTeamJoin(ctx, payload)
+		case "user_change":
+			go HandleUserEvent(ctx, payload)
+		}
+	}
+}
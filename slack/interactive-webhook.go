@@ -1,21 +1,26 @@
 package slack
 
 import (
-	"bytes"
 	"context"
-	"html/template"
-	"io/ioutil"
-	"log"
+	"encoding/json"
 	"net/http"
+	"strings"
 
 	"encore.dev/rlog"
-	"github.com/kollalabs/sdk-go/kc"
 	"github.com/tidwall/gjson"
 )
 
 var secrets struct {
-	ForgeDataAPIToken string
-	KollaAPIKey       string
+	ForgeDataAPIToken        string
+	KollaAPIKey              string
+	SlackProfileFieldMapping string
+	KollaWebhookSecret       string
+	// SlackSigningSecret checks requests to the slack endpoints really come from slack
+	SlackSigningSecret string
+	// SlackBotToken is optional, when set it is used instead of the internal-slack kolla credentials
+	SlackBotToken string
+	// SlackWorkspaces is optional, see Workspace
+	SlackWorkspaces string
 }
 
 //encore:api public raw method=POST path=/slack/interactive
@@ -25,12 +30,22 @@ func InteractiveRouter(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusMethodNotAllowed)
 		return
 	}
+	if _, ok := readSignedSlackRequest(w, r); !ok {
+		return
+	}
 	r.ParseForm()
 	payload := r.PostFormValue("payload")
 	rlog.Info("webhook", "payload", payload)
 
 	rlog.Debug("slack", "valid", gjson.Valid(payload))
 
+	ws, ok := workspaceByTeam(gjson.Get(payload, "team.id").String())
+	if !ok {
+		rlog.Info("Ignoring interaction from unknown workspace", "team", gjson.Get(payload, "team.id").String())
+		return
+	}
+	ctx = withWorkspace(ctx, ws)
+
 	//jsonStr, err := url.QueryUnescape(string(body)[8:])
 
 	webhookType := gjson.Get(payload, "type")
@@ -46,12 +61,68 @@ func InteractiveRouter(w http.ResponseWriter, r *http.Request) {
 				rlog.Error("Error sending Job Post Form", "err", err)
 				return
 			}
+		case "link_account":
+			rlog.Debug("Link Account Shortcut Fired")
+			go ChooseAccountToLink(ctx, gjson.Get(payload, "user.id").String(), "")
+			return
 		case "meetup_link":
-			rlog.Debug("Meetup Link Shortcut Fired", "payload", payload)
-			triggerID := gjson.Get(payload, "trigger_id").String()
+			// Kept for workspaces that still have the old meetup only shortcut
+			rlog.Debug("Meetup Link Shortcut Fired")
+			go ShowLinkStatus(ctx, connectorByKey("meetup"), gjson.Get(payload, "user.id").String(), "")
+			return
+		case "edit_profile":
+			rlog.Debug("Edit Profile Shortcut Fired")
+			go OpenProfileEditor(ctx, gjson.Get(payload, "trigger_id").String(), gjson.Get(payload, "user.id").String())
+			return
+		}
+	} else if webhookType.String() == "block_actions" {
+		actionID := gjson.Get(payload, "actions.0.action_id")
+		// switch statement to handle different types of block actions (buttons)
+		switch actionID.String() {
+		case "edit_profile":
+			rlog.Debug("Edit Profile Button Clicked")
+			go OpenProfileEditor(ctx, gjson.Get(payload, "trigger_id").String(), gjson.Get(payload, "user.id").String())
+			return
+		case "meetup_link":
+			// Onboarding DMs sent before accounts were generic still carry this button
+			rlog.Debug("Meetup Link Button Clicked")
+			go ShowLinkStatus(ctx, connectorByKey("meetup"), gjson.Get(payload, "user.id").String(), gjson.Get(payload, "response_url").String())
+			return
+		case "privacy_delete_confirm":
+			rlog.Debug("Privacy Delete Confirmed")
+			go ErasePrivacyData(ctx, gjson.Get(payload, "user.id").String(), gjson.Get(payload, "response_url").String())
+			return
+		case "privacy_delete_cancel":
+			go respondOrDMText(ctx, gjson.Get(payload, "user.id").String(), gjson.Get(payload, "response_url").String(), "Nothing was erased.")
+			return
+		case "relink_account", "unlink_account":
+			c := connectorByKey(gjson.Get(payload, "actions.0.value").String())
+			if c == nil {
+				rlog.Error("Unknown account connector", "value", gjson.Get(payload, "actions.0.value").String())
+				return
+			}
 			userID := gjson.Get(payload, "user.id").String()
-			go InitiateLinkMeetup(ctx, userID, triggerID)
+			responseURL := gjson.Get(payload, "response_url").String()
+			if actionID.String() == "relink_account" {
+				rlog.Debug("Relink Account Button Clicked", "connector", c.Key)
+				go RelinkAccount(ctx, c, userID, responseURL)
+			} else {
+				rlog.Debug("Unlink Account Button Clicked", "connector", c.Key)
+				go UnlinkAccount(ctx, c, userID, responseURL)
+			}
 			return
+		default:
+			// The account chooser has a link_account_<key> button per connector
+			if strings.HasPrefix(actionID.String(), "link_account_") {
+				c := connectorByKey(gjson.Get(payload, "actions.0.value").String())
+				if c == nil {
+					rlog.Error("Unknown account connector", "value", gjson.Get(payload, "actions.0.value").String())
+					return
+				}
+				rlog.Debug("Link Account Button Clicked", "connector", c.Key)
+				go ShowLinkStatus(ctx, c, gjson.Get(payload, "user.id").String(), gjson.Get(payload, "response_url").String())
+				return
+			}
 		}
 	} else if webhookType.String() == "view_submission" {
 		// What form was submitted
@@ -60,9 +131,23 @@ func InteractiveRouter(w http.ResponseWriter, r *http.Request) {
 		switch callbackID.String() {
 		case "job_post_submit":
 			rlog.Debug("Job Posting Form Submitted")
-			JobPostSubmit(payload)
+			go JobPostSubmit(ctx, payload)
 			// Get the values from the form
 			//company := gjson.Get(payload, "view.state.values.company.company.value")
+		case "profile_edit_submit":
+			rlog.Debug("Profile Edit Form Submitted")
+			edit, validationErrors := ProfileEditSubmit(payload)
+			if len(validationErrors) > 0 {
+				// Keep the modal open and show the errors next to the inputs
+				w.Header().Set("Content-Type", "application/json")
+				json.NewEncoder(w).Encode(map[string]interface{}{
+					"response_action": "errors",
+					"errors":          validationErrors,
+				})
+				return
+			}
+			// Slack closes the modal on an empty 200, the save happens after
+			go SaveProfileEdit(ctx, edit)
 		}
 	}
 
@@ -72,73 +157,23 @@ func InteractiveRouter(w http.ResponseWriter, r *http.Request) {
 
 // Send the Job Post form modal in slack to the person that ran the shortcut
 func JobPostForm(ctx context.Context, triggerID string) error {
-	// Open template file and parse it
-	t, err := template.New("job_post_form").Parse(tmplJobPostForm)
-	if err != nil {
-		rlog.Error("Error parsing template", "err", err)
-		return err
-	}
-	// Put variables in template
-	data := struct {
-		TriggerID string
-	}{triggerID}
-	// Execute template and write to buffer
-	var tpl bytes.Buffer
-	err = t.Execute(&tpl, data)
-	if err != nil {
-		rlog.Error("Error executing template", "err", err)
-		return err
-	}
-
-	kolla, err := kc.New(secrets.KollaAPIKey)
-	if err != nil {
-		rlog.Error("unable to load kolla connect client", "error", err)
-		return err
-	}
-	// Get consumer token
-	creds, err := kolla.Credentials(ctx, "internal-slack", "internal") // Use consumer ID set in consumer token
-	if err != nil {
-		log.Fatalf("unable to load consumer credentials: %s\n", err)
-		return err
-	}
-
-	req, err := http.NewRequest("POST", "https://slack.com/api/views.open", &tpl)
+	view, err := renderJSON("job_post_form", tmplJobPostForm, nil)
 	if err != nil {
-		rlog.Error("Error creating Job Post Form request", "err", err)
+		rlog.Error("Error rendering Job Post Form", "err", err)
 		return err
 	}
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+creds.Token)
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
-
-	if err != nil {
-		rlog.Error("Error sending Job Post Form", "err", err)
-		return err
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		rlog.Error("Error sending Job Post Form", "status", resp.StatusCode)
-		return err
-	}
-	// Get response body
-	body, err := ioutil.ReadAll(resp.Body)
-	// decode body
-	stringbody := string(body)
-	rlog.Debug("Job Post Form Sent", "status", resp.StatusCode)
-	rlog.Debug("Job Post Form Sent", "body", stringbody)
 
+	_, err = slackClient.ViewsOpen(ctx, triggerID, view)
 	if err != nil {
 		rlog.Error("Error sending Job Post Form", "err", err)
 		return err
 	}
+	rlog.Debug("Job Post Form Sent")
 
 	return nil
 }
 
-func JobPostSubmit(payload string) error {
+func JobPostSubmit(ctx context.Context, payload string) error {
 	// Get the values from the form
 	company := gjson.Get(payload, "view.state.values.company.company.value")
 	url := gjson.Get(payload, "view.state.values.url.url.value")
@@ -152,121 +187,99 @@ func JobPostSubmit(payload string) error {
 	rlog.Debug("Job Post Form Submitted", "description", description.Str)
 
 	// Load user from Forge Data API
-	// Create a new http client and make request
-	req, err := http.NewRequest("GET", "https://forge-api.fly.dev/api/people?filters[slack_id][$eq]="+userID.Str, nil)
-	if err != nil {
-		rlog.Error("Error creating person data api request", "err", err)
-	}
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+secrets.ForgeDataAPIToken)
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
-
-	// Check for error code
-	if resp.StatusCode != http.StatusOK {
-		rlog.Error("Error sending person search to forge data api", "status", resp.StatusCode)
-		return err
-	}
-
+	p, err := loadPersonBySlackID(ctx, userID.Str)
 	if err != nil {
-		rlog.Error("Error sending person search to forge data api", "err", err)
+		rlog.Error("Error loading person for job post", "slackID", userID.Str, "err", err)
 		return err
 	}
-	// Get response body and parse to json
-	body, err := ioutil.ReadAll(resp.Body)
-	// decode body
-	rlog.Debug("Person Search Response", "body", string(body))
+	rlog.Debug("Job Post Person", "person", p.ID)
 
 	return nil
 }
 
 // JobPosting Slack Modal/Form
 const tmplJobPostForm = `{
-    "trigger_id": "{{.TriggerID}}",
-    "view": {
-        "type": "modal",
-        "callback_id": "job_post_submit",
-        "title": {
-            "type": "plain_text",
-            "text": "Add Job Post",
-            "emoji": true
-        },
-        "submit": {
-            "type": "plain_text",
-            "text": "Submit",
-            "emoji": true
+    "type": "modal",
+    "callback_id": "job_post_submit",
+    "title": {
+        "type": "plain_text",
+        "text": "Add Job Post",
+        "emoji": true
+    },
+    "submit": {
+        "type": "plain_text",
+        "text": "Submit",
+        "emoji": true
+    },
+    "close": {
+        "type": "plain_text",
+        "text": "Cancel",
+        "emoji": true
+    },
+    "blocks": [
+        {
+            "type": "section",
+            "text": {
+                "type": "mrkdwn",
+                "text": "Fill out the information to add a job post to Forge Utah"
+            }
         },
-        "close": {
-            "type": "plain_text",
-            "text": "Cancel",
-            "emoji": true
+        {
+            "type": "divider"
         },
-        "blocks": [
-            {
-                "type": "section",
-                "text": {
-                    "type": "mrkdwn",
-                    "text": "Fill out the information to add a job post to Forge Utah"
-                }
+        {
+            "type": "input",
+			"block_id": "company",
+            "element": {
+                "type": "plain_text_input",
+                "action_id": "company"
             },
-            {
-                "type": "divider"
-            },
-            {
-                "type": "input",
-				"block_id": "company",
-                "element": {
-                    "type": "plain_text_input",
-                    "action_id": "company"
-                },
-                "label": {
-                    "type": "plain_text",
-                    "text": "Company Name",
-                    "emoji": true
-                }
+            "label": {
+                "type": "plain_text",
+                "text": "Company Name",
+                "emoji": true
+            }
+        },
+        {
+            "type": "input",
+			"block_id": "description",
+            "element": {
+                "type": "plain_text_input",
+                "multiline": true,
+                "action_id": "description"
             },
-            {
-                "type": "input",
-				"block_id": "description",
-                "element": {
-                    "type": "plain_text_input",
-                    "multiline": true,
-                    "action_id": "description"
-                },
-                "label": {
-                    "type": "plain_text",
-                    "text": "Description",
-                    "emoji": true
-                }
+            "label": {
+                "type": "plain_text",
+                "text": "Description",
+                "emoji": true
+            }
+        },
+		{
+            "type": "input",
+			"block_id": "url",
+            "element": {
+                "type": "url_text_input",
+                "action_id": "url"
             },
-			{
-                "type": "input",
-				"block_id": "url",
-                "element": {
-                    "type": "url_text_input",
-                    "action_id": "url"
-                },
-                "label": {
-                    "type": "plain_text",
-                    "text": "URL of Official Job Posting",
-                    "emoji": true
-                }
+            "label": {
+                "type": "plain_text",
+                "text": "URL of Official Job Posting",
+                "emoji": true
+            }
+        },
+        {
+            "type": "input",
+			"block_id": "email",
+			"optional": true,
+            "element": {
+                "type": "email_text_input",
+                "action_id": "contact_emil"
             },
-            {
-                "type": "input",
-				"block_id": "email",
-				"optional": true,
-                "element": {
-                    "type": "email_text_input",
-                    "action_id": "contact_emil"
-                },
-                "label": {
-                    "type": "plain_text",
-                    "text": "Contact Email",
-                    "emoji": true
-                }
+            "label": {
+                "type": "plain_text",
+                "text": "Contact Email",
+                "emoji": true
             }
-        ]
-    }
+        }
+    ]
 }`
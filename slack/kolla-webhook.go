@@ -0,0 +1,163 @@
+package slack
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+
+	"encore.dev/rlog"
+)
+
+// Kolla webhook signatures older than this are rejected so a captured request can't be replayed
+const kollaSignatureTolerance = 5 * time.Minute
+
+// Link event types kolla sends for connect links
+const (
+	kollaLinkCompleted = "link.completed"
+	kollaLinkExpired   = "link.expired"
+	kollaLinkFailed    = "link.failed"
+)
+
+// KollaLinkEvent is the body of a kolla link webhook
+type KollaLinkEvent struct {
+	Type          string `json:"type"`
+	Connector     string `json:"connector"`
+	ConsumerID    string `json:"consumer_id"`
+	LinkedAccount string `json:"linked_account"`
+	StateMessage  string `json:"state_message"`
+}
+
+//encore:api public raw method=POST path=/slack/kolla/events
+func KollaWebhook(w http.ResponseWriter, r *http.Request) {
+	// Nobody is waiting on these in slack, so slack calls can queue for the rate limit
+	ctx := withBackgroundPriority(context.Background())
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		rlog.Error("Error reading kolla webhook body", "err", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	err = verifyKollaSignature(secrets.KollaWebhookSecret, r.Header.Get("X-Kolla-Timestamp"), r.Header.Get("X-Kolla-Signature"), body, time.Now())
+	if err != nil {
+		rlog.Error("Rejected kolla webhook", "err", err)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	event := KollaLinkEvent{}
+	err = json.Unmarshal(body, &event)
+	if err != nil {
+		rlog.Error("Error decoding kolla webhook", "err", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	rlog.Debug("kolla webhook", "type", event.Type, "connector", event.Connector, "consumer", event.ConsumerID)
+	c := connectorByKolla(event.Connector)
+	if c == nil {
+		rlog.Info("Ignoring kolla webhook for unregistered connector", "connector", event.Connector)
+		return
+	}
+
+	ws, slackID, ok := workspaceMember(event.ConsumerID)
+	if !ok {
+		rlog.Info("Ignoring kolla webhook for unknown workspace", "consumer", event.ConsumerID)
+		return
+	}
+	ctx = withWorkspace(ctx, ws)
+
+	// The connect link has been used up either way, the next request should get a fresh one
+	forgetPendingLink(event.Connector, event.ConsumerID)
+
+	switch event.Type {
+	case kollaLinkCompleted:
+		go CompleteAccountLink(ctx, c, slackID)
+	case kollaLinkExpired, kollaLinkFailed:
+		go NotifyLinkFailed(ctx, c, slackID, event)
+	}
+}
+
+// verifyKollaSignature checks the hex HMAC-SHA256 of "<timestamp>.<body>" kolla signs webhooks with
+func verifyKollaSignature(secret string, timestamp string, signature string, body []byte, now time.Time) error {
+	if secret == "" {
+		return fmt.Errorf("kolla webhook secret is not set")
+	}
+	unix, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return fmt.Errorf("bad signature timestamp %q", timestamp)
+	}
+	age := now.Sub(time.Unix(unix, 0))
+	if age > kollaSignatureTolerance || age < -kollaSignatureTolerance {
+		return fmt.Errorf("signature timestamp %s is outside the tolerance", time.Unix(unix, 0))
+	}
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	expected := hex.EncodeToString(mac.Sum(nil))
+	if !hmac.Equal([]byte(expected), []byte(signature)) {
+		return fmt.Errorf("signature mismatch")
+	}
+	return nil
+}
+
+// NotifyLinkFailed tells the member their link didn't go through and offers a new one
+func NotifyLinkFailed(ctx context.Context, c *AccountConnector, slackID string, event KollaLinkEvent) error {
+	reason := "expired before it was used"
+	if event.Type == kollaLinkFailed {
+		reason = "didn't go through"
+		if event.StateMessage != "" {
+			reason += ": " + event.StateMessage
+		}
+	}
+	rlog.Info("Account link not completed", "connector", c.Key, "slackID", slackID, "type", event.Type, "message", event.StateMessage)
+
+	msg := &Message{
+		Channel: slackID,
+		Text:    "Your " + c.Name + " link " + reason + ".",
+	}
+	blocks, err := json.Marshal([]interface{}{
+		map[string]interface{}{
+			"type": "section",
+			"text": map[string]string{"type": "mrkdwn", "text": msg.Text},
+		},
+		map[string]interface{}{
+			"type": "actions",
+			"elements": []interface{}{
+				map[string]interface{}{
+					"type":      "button",
+					"action_id": "link_account_" + c.Key,
+					"value":     c.Key,
+					"text":      map[string]string{"type": "plain_text", "text": "Try again"},
+				},
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	msg.Blocks = blocks
+	_, err = slackClient.ChatPostMessage(ctx, msg)
+	if err != nil {
+		rlog.Error("Error sending slack message", "err", err)
+		return err
+	}
+	return nil
+}
+
+// sendDirectMessage DMs plain text to a slack user
+func sendDirectMessage(ctx context.Context, slackID string, text string) error {
+	_, err := slackClient.ChatPostMessage(ctx, &Message{Channel: slackID, Text: text})
+	if err != nil {
+		rlog.Error("Error sending slack message", "err", err)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,47 @@
+package slack
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func signKolla(secret string, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestVerifyKollaSignature(t *testing.T) {
+	const secret = "whsec_test"
+	body := []byte(`{"type":"link.completed","connector":"meetup-kolla","consumer_id":"UC81JHDJ6"}`)
+	now := time.Unix(1687305600, 0)
+	ts := strconv.FormatInt(now.Unix(), 10)
+	stale := strconv.FormatInt(now.Add(-time.Hour).Unix(), 10)
+
+	tests := []struct {
+		name      string
+		secret    string
+		timestamp string
+		signature string
+		body      []byte
+		wantErr   bool
+	}{
+		{"valid", secret, ts, signKolla(secret, ts, body), body, false},
+		{"wrong secret", secret, ts, signKolla("other", ts, body), body, true},
+		{"tampered body", secret, ts, signKolla(secret, ts, body), []byte(`{"type":"link.completed","consumer_id":"U0EVIL"}`), true},
+		{"stale timestamp", secret, stale, signKolla(secret, stale, body), body, true},
+		{"missing timestamp", secret, "", signKolla(secret, "", body), body, true},
+		{"no secret configured", "", ts, signKolla("", ts, body), body, true},
+	}
+	for _, tt := range tests {
+		err := verifyKollaSignature(tt.secret, tt.timestamp, tt.signature, tt.body, now)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: verifyKollaSignature() = %v, wantErr %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,351 @@
+package slack
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"encore.app/data"
+	"encore.dev/rlog"
+)
+
+type ConnectorLinkRequest struct {
+	ConsumerID       string `json:"consumer_id"`
+	ConsumerMetadata struct {
+		Title string `json:"title"`
+		Email string `json:"email"`
+	} `json:"consumer_metadata"`
+}
+
+type ConnectorLinkResponse struct {
+	Name             string `json:"name"`
+	URI              string `json:"uri"`
+	Connector        string `json:"connector"`
+	ConsumerID       string `json:"consumer_id"`
+	ConsumerMetadata struct {
+		Title string `json:"title"`
+		Email string `json:"email"`
+	} `json:"consumer_metadata"`
+	CreateTime time.Time `json:"create_time"`
+	ExpireTime time.Time `json:"expire_time"`
+}
+
+// A pending link is only reused if the member has at least this long left to click it
+const linkReuseMargin = 5 * time.Minute
+
+// pendingLinks remembers the connect links we handed out by connector and consumer id so asking again reuses an unexpired one
+var pendingLinks = struct {
+	sync.Mutex
+	links map[string]*ConnectorLinkResponse
+}{links: map[string]*ConnectorLinkResponse{}}
+
+// ChooseAccountToLink asks the member which of the registered accounts they want to link
+func ChooseAccountToLink(ctx context.Context, slackID string, responseURL string) error {
+	chooser := struct {
+		UserID     string
+		Connectors []*AccountConnector
+	}{slackID, accountConnectors}
+	msg, err := renderMessage("link_account_chooser", tmplLinkAccountChooser, chooser)
+	if err != nil {
+		rlog.Error("Error rendering account chooser", "err", err)
+		return err
+	}
+
+	return respondOrDM(ctx, responseURL, msg)
+}
+
+// ShowLinkStatus tells the member whether their account is linked and offers to link, relink or unlink.
+// The status is sent to responseURL when the request came from a slash command or message button, otherwise as a DM.
+func ShowLinkStatus(ctx context.Context, c *AccountConnector, slackID string, responseURL string) error {
+	p, err := SyncSlackUserToDataApi(ctx, slackID)
+	if err != nil {
+		return err
+	}
+
+	status := struct {
+		UserID  string
+		Key     string
+		Name    string
+		Linked  bool
+		Account string
+		LinkURI string
+	}{UserID: slackID, Key: c.Key, Name: c.Name, Account: c.Account(p)}
+
+	_, err = linkedAccount(ctx, c, slackID)
+	if err != nil && !errors.Is(err, ErrNoLinkedAccount) {
+		// Offering a new link here could make the member replace an account that is still linked
+		rlog.Error("Error checking account link", "connector", c.Key, "slackID", slackID, "err", err)
+		respondOrDMText(ctx, slackID, responseURL, "Sorry, I couldn't check your "+c.Name+" account. Please try again later.")
+		return err
+	}
+	status.Linked = err == nil
+	if !status.Linked {
+		link, err := connectLink(ctx, c, p, false)
+		if err != nil {
+			return err
+		}
+		status.LinkURI = link.URI
+	}
+
+	msg, err := renderMessage("link_status", tmplLinkStatus, status)
+	if err != nil {
+		rlog.Error("Error rendering link status", "err", err)
+		return err
+	}
+
+	return respondOrDM(ctx, responseURL, msg)
+}
+
+// RelinkAccount hands out a brand new connect link so the member can link a different account
+func RelinkAccount(ctx context.Context, c *AccountConnector, slackID string, responseURL string) error {
+	p, err := SyncSlackUserToDataApi(ctx, slackID)
+	if err != nil {
+		return err
+	}
+	link, err := connectLink(ctx, c, p, true)
+	if err != nil {
+		return err
+	}
+	return respondOrDMText(ctx, slackID, responseURL, "<"+link.URI+"|Click here to link your "+c.Name+" account>")
+}
+
+// UnlinkAccount revokes the member's kolla link and clears what the connector filled in on their person
+func UnlinkAccount(ctx context.Context, c *AccountConnector, slackID string, responseURL string) error {
+	name, err := linkedAccount(ctx, c, slackID)
+	if err != nil && !errors.Is(err, ErrNoLinkedAccount) {
+		// Clearing the profile while kolla still has the link would leave it half unlinked
+		rlog.Error("Error checking account link", "connector", c.Key, "slackID", slackID, "err", err)
+		respondOrDMText(ctx, slackID, responseURL, "Sorry, I couldn't unlink your "+c.Name+" account. Please try again later.")
+		return err
+	}
+	if err == nil {
+		err = disableKollaLinkedAccount(ctx, name)
+		if err != nil {
+			rlog.Error("Error revoking account link", "connector", c.Key, "slackID", slackID, "err", err)
+			return err
+		}
+		credentialProvider().Forget(c.KollaConnector, memberConsumerID(workspaceFrom(ctx), slackID))
+	}
+
+	p, err := loadOrSyncPerson(ctx, slackID)
+	if err != nil {
+		return err
+	}
+	if c.Account(p) != "" {
+		_, err = updatePersonWithRetry(ctx, p, func(*data.Person) *data.PersonUpdate {
+			return c.Clear()
+		})
+		if err != nil {
+			rlog.Error("Error clearing linked account", "connector", c.Key, "slackID", slackID, "err", err)
+			return err
+		}
+	}
+
+	return respondOrDMText(ctx, slackID, responseURL, "Your "+c.Name+" account is no longer linked to your Forge profile.")
+}
+
+// CompleteAccountLink runs the connector's enrichment for a freshly linked account, saves it on the person and lets them know
+func CompleteAccountLink(ctx context.Context, c *AccountConnector, slackID string) error {
+	// The member may have linked a different account than the one we have cached
+	consumerID := memberConsumerID(workspaceFrom(ctx), slackID)
+	credentialProvider().Forget(c.KollaConnector, consumerID)
+	creds, err := credentialProvider().Credentials(ctx, c.KollaConnector, consumerID)
+	if err != nil {
+		rlog.Error("unable to load linked account credentials", "connector", c.Key, "slackID", slackID, "error", err)
+		return err
+	}
+	update, err := c.Enrich(ctx, creds.Token)
+	if err != nil {
+		rlog.Error("Error loading linked account", "connector", c.Key, "slackID", slackID, "err", err)
+		return err
+	}
+
+	p, err := loadOrSyncPerson(ctx, slackID)
+	if err != nil {
+		return err
+	}
+	p, err = updatePersonWithRetry(ctx, p, func(*data.Person) *data.PersonUpdate {
+		return update
+	})
+	if err != nil {
+		rlog.Error("Error saving linked account", "connector", c.Key, "slackID", slackID, "err", err)
+		return err
+	}
+	trackOnboardingProgress(ctx, p)
+
+	return sendDirectMessage(ctx, slackID, "Your "+c.Name+" account is linked to your Forge profile.")
+}
+
+// linkedAccount returns the resource name of the member's kolla linked account, or ErrNoLinkedAccount if there is none
+func linkedAccount(ctx context.Context, c *AccountConnector, slackID string) (string, error) {
+	creds, err := credentialProvider().Credentials(ctx, c.KollaConnector, memberConsumerID(workspaceFrom(ctx), slackID))
+	if err != nil {
+		rlog.Debug("No linked account", "connector", c.Key, "slackID", slackID, "error", err)
+		return "", err
+	}
+	return creds.LinkedAccount, nil
+}
+
+// connectLink returns the member's pending connect link if it is still good, otherwise asks kolla for a new one
+func connectLink(ctx context.Context, c *AccountConnector, p *data.Person, forceNew bool) (*ConnectorLinkResponse, error) {
+	consumerID := memberConsumerID(workspaceFrom(ctx), p.Attributes.SlackID)
+	key := c.KollaConnector + "/" + consumerID
+	pendingLinks.Lock()
+	pending, ok := pendingLinks.links[key]
+	pendingLinks.Unlock()
+	if ok && !forceNew && time.Until(pending.ExpireTime) > linkReuseMargin {
+		rlog.Debug("Reusing pending link", "connector", c.Key, "slackID", consumerID, "expires", pending.ExpireTime)
+		return pending, nil
+	}
+
+	// Get connect link from kolla
+	connectorLinkRequest := ConnectorLinkRequest{}
+	connectorLinkRequest.ConsumerID = consumerID
+	connectorLinkRequest.ConsumerMetadata.Title = p.Attributes.DisplayName
+	connectorLinkRequest.ConsumerMetadata.Email = p.Attributes.Email
+
+	connectorLinkResponse := &ConnectorLinkResponse{}
+	err := callJSON(ctx, "kolla", "POST", "https://connect.getkolla.com/v1/connectors/"+c.KollaConnector+"/links", secrets.KollaAPIKey, nil, connectorLinkRequest, connectorLinkResponse)
+	if err != nil {
+		rlog.Error("Error requesting connect link from kolla", "connector", c.Key, "err", err)
+		return nil, err
+	}
+
+	pendingLinks.Lock()
+	pendingLinks.links[key] = connectorLinkResponse
+	pendingLinks.Unlock()
+
+	return connectorLinkResponse, nil
+}
+
+// forgetPendingLink drops a pending link once it has been used, expired or failed
+func forgetPendingLink(kollaConnector string, consumerID string) {
+	pendingLinks.Lock()
+	delete(pendingLinks.links, kollaConnector+"/"+consumerID)
+	pendingLinks.Unlock()
+}
+
+// Asks which account to link, one button per registered connector
+const tmplLinkAccountChooser = `{
+    "channel": "{{.UserID}}",
+    "response_type": "ephemeral",
+    "replace_original": true,
+    "text": "Which account would you like to link to your Forge profile?",
+    "blocks": [
+        {
+            "type": "section",
+            "text": {
+                "type": "mrkdwn",
+                "text": "Which account would you like to link to your Forge profile?"
+            }
+        },
+        {
+            "type": "actions",
+            "elements": [
+                {{- range $i, $c := .Connectors}}{{if $i}},{{end}}
+                {
+                    "type": "button",
+                    "action_id": {{json (printf "link_account_%s" $c.Key)}},
+                    "value": {{json $c.Key}},
+                    "text": {
+                        "type": "plain_text",
+                        "text": {{json $c.Name}},
+                        "emoji": true
+                    }
+                }
+                {{- end}}
+            ]
+        }
+    ]
+}`
+
+// Link status message, linked members get relink and unlink, everyone else gets the connect link
+const tmplLinkStatus = `{
+    "channel": "{{.UserID}}",
+    "response_type": "ephemeral",
+    "replace_original": true,
+    {{- if .Linked}}
+    "text": {{json (printf "Your %s account is linked to your Forge profile." .Name)}},
+    "blocks": [
+        {
+            "type": "section",
+            "text": {
+                "type": "mrkdwn",
+                "text": {{json (printf "Your %s account is linked to your Forge profile%s." .Name (or (and .Account (printf " (%s)" .Account)) ""))}}
+            }
+        },
+        {
+            "type": "actions",
+            "elements": [
+                {
+                    "type": "button",
+                    "action_id": "relink_account",
+                    "value": {{json .Key}},
+                    "text": {
+                        "type": "plain_text",
+                        "text": "Relink",
+                        "emoji": true
+                    }
+                },
+                {
+                    "type": "button",
+                    "action_id": "unlink_account",
+                    "value": {{json .Key}},
+                    "style": "danger",
+                    "text": {
+                        "type": "plain_text",
+                        "text": "Unlink",
+                        "emoji": true
+                    },
+                    "confirm": {
+                        "title": {
+                            "type": "plain_text",
+                            "text": {{json (printf "Unlink %s?" .Name)}}
+                        },
+                        "text": {
+                            "type": "plain_text",
+                            "text": {{json (printf "Forge will stop using your %s account until you link it again." .Name)}}
+                        },
+                        "confirm": {
+                            "type": "plain_text",
+                            "text": "Unlink"
+                        },
+                        "deny": {
+                            "type": "plain_text",
+                            "text": "Keep it"
+                        }
+                    }
+                }
+            ]
+        }
+    ]
+    {{- else}}
+    "text": {{json (printf "Your %s account isn't linked yet." .Name)}},
+    "blocks": [
+        {
+            "type": "section",
+            "text": {
+                "type": "mrkdwn",
+                "text": {{json (printf "Your %s account isn't linked to your Forge profile yet." .Name)}}
+            }
+        },
+        {
+            "type": "actions",
+            "elements": [
+                {
+                    "type": "button",
+                    "action_id": "connect_account",
+                    "style": "primary",
+                    "url": {{json .LinkURI}},
+                    "text": {
+                        "type": "plain_text",
+                        "text": {{json (printf "Link my %s account" .Name)}},
+                        "emoji": true
+                    }
+                }
+            ]
+        }
+    ]
+    {{- end}}
+}`
@@ -0,0 +1,127 @@
+package slack
+
+import (
+	"context"
+	"fmt"
+
+	"encore.app/data"
+	"encore.dev/beta/errs"
+	"encore.dev/rlog"
+)
+
+// MemberSyncReport counts what happened to each workspace member during a sync
+type MemberSyncReport struct {
+	Created   int
+	Updated   int
+	Unchanged int
+	Failed    int
+}
+
+// SyncWorkspaceMembers upserts every human member of every workspace into the Forge Data API.
+// It is run on a schedule, organizers can run it on demand with RunMemberSync.
+// encore:api private method=POST path=/slack/members/sync/scheduled
+func SyncWorkspaceMembers(ctx context.Context) (*MemberSyncReport, error) {
+	report := &MemberSyncReport{}
+	ctx = withBackgroundPriority(ctx)
+
+	// One workspace failing shouldn't keep the others from syncing
+	var syncErr error
+	for _, ws := range allWorkspaces() {
+		err := syncMembers(withWorkspace(ctx, ws), report)
+		if err != nil && syncErr == nil {
+			syncErr = err
+		}
+	}
+
+	rlog.Info("Workspace member sync finished", "created", report.Created, "updated", report.Updated,
+		"unchanged", report.Unchanged, "failed", report.Failed)
+	return report, syncErr
+}
+
+// syncMembers upserts the members of the workspace ctx acts on, adding the outcomes to report
+func syncMembers(ctx context.Context, report *MemberSyncReport) error {
+	cursor := ""
+	for {
+		page, err := slackClient.UsersList(ctx, cursor)
+		if err != nil {
+			rlog.Error("Error listing workspace members", "team", workspaceFrom(ctx).TeamID, "err", err, "report", report)
+			return err
+		}
+
+		for _, member := range page.Members {
+			if !isHumanMember(member) {
+				continue
+			}
+			syncMember(ctx, member, report)
+		}
+
+		cursor = page.ResponseMetadata.NextCursor
+		if cursor == "" {
+			return nil
+		}
+	}
+}
+
+// RunMemberSync lets an organizer run the workspace member sync right away
+// encore:api auth method=POST path=/slack/members/sync
+func RunMemberSync(ctx context.Context) (*MemberSyncReport, error) {
+	if err := data.RequireOrganizer(); err != nil {
+		return nil, err
+	}
+	return SyncWorkspaceMembers(ctx)
+}
+
+// SyncMembersCommand runs the member sync for the workspace `/forge sync` came from, if the member is one of its organizers
+func SyncMembersCommand(ctx context.Context, slackID string, responseURL string) error {
+	organizer, err := isWorkspaceOrganizer(ctx, slackID)
+	if err != nil {
+		rlog.Error("Error loading workspace organizers", "team", workspaceFrom(ctx).TeamID, "err", err)
+		return err
+	}
+	if !organizer {
+		return respondOrDMText(ctx, slackID, responseURL, "Only organizers can sync members.")
+	}
+
+	report := &MemberSyncReport{}
+	err = syncMembers(withBackgroundPriority(ctx), report)
+	if err != nil {
+		return respondOrDMText(ctx, slackID, responseURL, "The member sync stopped early, check the logs.")
+	}
+	return respondOrDMText(ctx, slackID, responseURL, fmt.Sprintf("Member sync finished: %d created, %d updated, %d unchanged, %d failed.",
+		report.Created, report.Updated, report.Unchanged, report.Failed))
+}
+
+// syncMember upserts one member and records the outcome on the report
+func syncMember(ctx context.Context, member SlackUser, report *MemberSyncReport) {
+	existing, err := loadPersonBySlackID(ctx, member.ID)
+	if err != nil {
+		if e, ok := err.(*errs.Error); !ok || e.Code != errs.NotFound {
+			rlog.Error("Error loading person for member sync", "slackID", member.ID, "err", err)
+			report.Failed++
+			return
+		}
+		existing = nil
+	}
+	update := slackUserChange(existing, member)
+	if update == nil {
+		report.Unchanged++
+		return
+	}
+
+	_, err = upsertPersonBySlackID(ctx, member.ID, update)
+	if err != nil {
+		rlog.Error("Error upserting person for member sync", "slackID", member.ID, "err", err)
+		report.Failed++
+		return
+	}
+	if existing == nil {
+		report.Created++
+	} else {
+		report.Updated++
+	}
+}
+
+// isHumanMember skips bots and slackbot. Deactivated members are kept so their person gets marked inactive.
+func isHumanMember(u SlackUser) bool {
+	return !u.IsBot && u.ID != "USLACKBOT"
+}
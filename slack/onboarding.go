@@ -0,0 +1,303 @@
+package slack
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"encore.app/data"
+	"encore.dev/beta/errs"
+	"encore.dev/rlog"
+)
+
+// HandleTeamJoin creates the person for a new member and sends them the welcome DM
+func HandleTeamJoin(ctx context.Context, payload string) error {
+	err := HandleUserEvent(ctx, payload)
+	if err != nil {
+		return err
+	}
+	u, err := slackUserFromEvent(payload)
+	if err != nil || !isHumanMember(u) {
+		return err
+	}
+	return WelcomeNewMember(ctx, u.ID)
+}
+
+// WelcomeNewMember DMs the organizer written welcome message and starts tracking their onboarding.
+// Members that already started onboarding are skipped so a redelivered team_join doesn't welcome twice.
+func WelcomeNewMember(ctx context.Context, slackID string) error {
+	p, err := loadPersonBySlackID(ctx, slackID)
+	if err != nil {
+		rlog.Error("Error loading person for welcome", "slackID", slackID, "err", err)
+		return err
+	}
+	claimed, err := claimWelcome(ctx, p)
+	if err != nil {
+		rlog.Error("Error saving onboarding progress", "slackID", slackID, "err", err)
+		return err
+	}
+	if !claimed {
+		rlog.Debug("Member already welcomed", "slackID", slackID)
+		return nil
+	}
+
+	content, err := data.LoadOnboardingContent(ctx)
+	if err != nil {
+		return err
+	}
+	content = workspaceOnboardingContent(ctx, content)
+	message := content.WelcomeMessage
+	if message == "" {
+		message = fmt.Sprintf("Welcome to Forge Utah, <@%s>!", slackID)
+	}
+	// The member is already marked welcomed, if the DM fails the follow up still reaches them
+	return sendOnboardingMessage(ctx, slackID, message, content, p)
+}
+
+// claimWelcome marks the member welcomed before the welcome DM goes out. The update is checked against the
+// version that was read, so when slack redelivers team_join only one delivery gets to send the DM.
+func claimWelcome(ctx context.Context, p *data.Person) (bool, error) {
+	status := data.OnboardingWelcomed
+	startedAt := time.Now().UTC().Format(time.RFC3339)
+	for attempt := 1; ; attempt++ {
+		if p.Attributes.OnboardingStatus != "" {
+			return false, nil
+		}
+		_, err := data.UpdatePerson(ctx, p.ID, &data.PersonUpdate{
+			Version:             p.Attributes.UpdatedAt,
+			OnboardingStatus:    &status,
+			OnboardingStartedAt: &startedAt,
+		})
+		if err == nil {
+			return true, nil
+		}
+		if e, ok := err.(*errs.Error); !ok || e.Code != errs.Aborted || attempt == personUpdateAttempts {
+			return false, err
+		}
+		// Either another delivery claimed the welcome or something else changed the person, the re-read tells
+		p, err = data.LoadPerson(ctx, p.ID, &data.LoadPersonParams{Fresh: true})
+		if err != nil {
+			return false, err
+		}
+	}
+}
+
+// OnboardingFollowUpReport counts what the follow up run did
+type OnboardingFollowUpReport struct {
+	FollowedUp int
+	Completed  int
+	Failed     int
+}
+
+// FollowUpOnboarding nudges members whose profile is still incomplete a few days after they were welcomed
+// encore:api private method=POST path=/slack/onboarding/follow-up
+func FollowUpOnboarding(ctx context.Context) (*OnboardingFollowUpReport, error) {
+	report := &OnboardingFollowUpReport{}
+	ctx = withBackgroundPriority(ctx)
+
+	content, err := data.LoadOnboardingContent(ctx)
+	if err != nil {
+		return report, err
+	}
+	startedBefore := time.Now().UTC().AddDate(0, 0, -content.FollowUpDays).Format(time.RFC3339)
+
+	var followUpErr error
+	for _, ws := range allWorkspaces() {
+		err := followUpWorkspace(withWorkspace(ctx, ws), content, startedBefore, report)
+		if err != nil && followUpErr == nil {
+			followUpErr = err
+		}
+	}
+
+	rlog.Info("Onboarding follow up finished", "followed_up", report.FollowedUp, "completed", report.Completed, "failed", report.Failed)
+	return report, followUpErr
+}
+
+// followUpWorkspace follows up with the members of the workspace ctx acts on, adding the outcomes to report
+func followUpWorkspace(ctx context.Context, content *data.OnboardingContent, startedBefore string, report *OnboardingFollowUpReport) error {
+	due, err := data.ListPeopleDueOnboardingFollowUp(ctx, &data.OnboardingFollowUpParams{
+		StartedBefore: startedBefore,
+		Tenant:        workspaceFrom(ctx).Tenant,
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, p := range due.People {
+		// Erased members asked to be left alone
+		if p.Attributes.Inactive || p.Attributes.ErasedAt != "" {
+			continue
+		}
+		if profileComplete(p) {
+			if err := markOnboardingCompleted(ctx, p); err != nil {
+				report.Failed++
+				continue
+			}
+			report.Completed++
+			continue
+		}
+
+		message := content.FollowUpMessage
+		if message == "" {
+			message = "Hey, you're almost set up in Forge Utah! Finish these so the community can find you."
+		}
+		err := sendOnboardingMessage(ctx, p.Attributes.SlackID, message, nil, p)
+		if err != nil {
+			report.Failed++
+			continue
+		}
+		status := data.OnboardingFollowedUp
+		_, err = updatePersonWithRetry(ctx, p, func(*data.Person) *data.PersonUpdate {
+			return &data.PersonUpdate{OnboardingStatus: &status}
+		})
+		if err != nil {
+			rlog.Error("Error saving onboarding progress", "slackID", p.Attributes.SlackID, "err", err)
+			report.Failed++
+			continue
+		}
+		report.FollowedUp++
+	}
+	return nil
+}
+
+// profileComplete is what onboarding asks new members to do: write a bio and link meetup
+func profileComplete(p *data.Person) bool {
+	return p.Attributes.Bio != "" && p.Attributes.MeetupID != ""
+}
+
+// trackOnboardingProgress marks onboarding completed once a member in onboarding finishes their profile
+func trackOnboardingProgress(ctx context.Context, p *data.Person) {
+	status := p.Attributes.OnboardingStatus
+	if (status != data.OnboardingWelcomed && status != data.OnboardingFollowedUp) || !profileComplete(p) {
+		return
+	}
+	markOnboardingCompleted(ctx, p)
+}
+
+func markOnboardingCompleted(ctx context.Context, p *data.Person) error {
+	status := data.OnboardingCompleted
+	completedAt := time.Now().UTC().Format(time.RFC3339)
+	_, err := updatePersonWithRetry(ctx, p, func(*data.Person) *data.PersonUpdate {
+		return &data.PersonUpdate{OnboardingStatus: &status, OnboardingCompletedAt: &completedAt}
+	})
+	if err != nil {
+		rlog.Error("Error saving onboarding progress", "slackID", p.Attributes.SlackID, "err", err)
+	}
+	return err
+}
+
+// sendOnboardingMessage DMs the message with buttons for whatever the member still has to do.
+// The code of conduct and channel recommendations are only included when content is given.
+func sendOnboardingMessage(ctx context.Context, slackID string, message string, content *data.OnboardingContent, p *data.Person) error {
+	onboarding := struct {
+		UserID           string
+		Message          string
+		CodeOfConductURL string
+		ChannelsText     string
+		NeedsProfile     bool
+		NeedsMeetup      bool
+	}{
+		UserID:       slackID,
+		Message:      message,
+		NeedsProfile: p.Attributes.Bio == "",
+		NeedsMeetup:  p.Attributes.MeetupID == "",
+	}
+	if content != nil {
+		onboarding.CodeOfConductURL = content.CodeOfConductURL
+		onboarding.ChannelsText = channelsText(content.Channels)
+	}
+
+	msg, err := renderMessage("onboarding_message", tmplOnboardingMessage, onboarding)
+	if err != nil {
+		rlog.Error("Error rendering onboarding message", "err", err)
+		return err
+	}
+
+	_, err = slackClient.ChatPostMessage(ctx, msg)
+	if err != nil {
+		rlog.Error("Error sending onboarding message", "slackID", slackID, "err", err)
+		return err
+	}
+	return nil
+}
+
+// channelsText lists the recommended channels as mrkdwn
+func channelsText(channels []data.OnboardingChannel) string {
+	if len(channels) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteString("*Channels to check out*")
+	for _, c := range channels {
+		b.WriteString("\n• <#" + c.ChannelID + ">")
+		if c.Description != "" {
+			b.WriteString(" " + c.Description)
+		}
+	}
+	return b.String()
+}
+
+// Onboarding DM
+const tmplOnboardingMessage = `{
+    "channel": "{{.UserID}}",
+    "text": {{json .Message}},
+    "blocks": [
+        {
+            "type": "section",
+            "text": {
+                "type": "mrkdwn",
+                "text": {{json .Message}}
+            }
+        }
+        {{- if .CodeOfConductURL}},
+        {
+            "type": "section",
+            "text": {
+                "type": "mrkdwn",
+                "text": {{json (printf "Please take a minute to read our <%s|code of conduct>." .CodeOfConductURL)}}
+            }
+        }
+        {{- end}}
+        {{- if .ChannelsText}},
+        {
+            "type": "section",
+            "text": {
+                "type": "mrkdwn",
+                "text": {{json .ChannelsText}}
+            }
+        }
+        {{- end}}
+        {{- if or .NeedsProfile .NeedsMeetup}},
+        {
+            "type": "actions",
+            "elements": [
+                {{- if .NeedsProfile}}
+                {
+                    "type": "button",
+                    "action_id": "edit_profile",
+                    "style": "primary",
+                    "text": {
+                        "type": "plain_text",
+                        "text": "Complete my Forge profile",
+                        "emoji": true
+                    }
+                }{{if .NeedsMeetup}},{{end}}
+                {{- end}}
+                {{- if .NeedsMeetup}}
+                {
+                    "type": "button",
+                    "action_id": "link_account_meetup",
+                    "value": "meetup",
+                    "text": {
+                        "type": "plain_text",
+                        "text": "Link my Meetup account",
+                        "emoji": true
+                    }
+                }
+                {{- end}}
+            ]
+        }
+        {{- end}}
+    ]
+}`
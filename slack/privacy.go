@@ -0,0 +1,203 @@
+package slack
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+
+	"encore.app/data"
+	"encore.dev/rlog"
+)
+
+// Each export message stays well under slack's 40,000 character limit
+const maxExportMessageChars = 30000
+
+// PrivacyExport is the bundle `/forge privacy export` sends
+type PrivacyExport struct {
+	People         []*data.Person
+	JobPosts       []*data.JobPost
+	LinkedAccounts []LinkedAccountExport
+}
+
+type LinkedAccountExport struct {
+	Connector string
+	// Account is what forge shows for the account, e.g. the github user
+	Account string
+	// LinkedAccount is the kolla linked account holding the access token
+	LinkedAccount string
+}
+
+// ExportPrivacyData DMs the member everything forge holds about them as JSON
+func ExportPrivacyData(ctx context.Context, slackID string, responseURL string) error {
+	stored, err := data.ExportPersonData(ctx, slackID, &data.PersonLookupParams{Tenant: workspaceFrom(ctx).Tenant})
+	if err != nil {
+		rlog.Error("Error exporting personal data", "slackID", slackID, "err", err)
+		respondOrDMText(ctx, slackID, responseURL, "Sorry, I couldn't collect your data. Please try again later.")
+		return err
+	}
+	export := &PrivacyExport{
+		People:         stored.People,
+		JobPosts:       stored.JobPosts,
+		LinkedAccounts: []LinkedAccountExport{},
+	}
+	for _, c := range accountConnectors {
+		name, err := linkedAccount(ctx, c, slackID)
+		if errors.Is(err, ErrNoLinkedAccount) {
+			continue
+		}
+		if err != nil {
+			// An export that quietly leaves out an account would be wrong
+			rlog.Error("Error checking account link for export", "connector", c.Key, "slackID", slackID, "err", err)
+			respondOrDMText(ctx, slackID, responseURL, "Sorry, I couldn't check your "+c.Name+" account. Please try again later.")
+			return err
+		}
+		account := LinkedAccountExport{Connector: c.Name, LinkedAccount: name}
+		if len(stored.People) > 0 {
+			account.Account = c.Account(stored.People[0])
+		}
+		export.LinkedAccounts = append(export.LinkedAccounts, account)
+	}
+
+	b, err := json.MarshalIndent(export, "", "  ")
+	if err != nil {
+		return err
+	}
+	for i, chunk := range chunkLines(string(b), maxExportMessageChars) {
+		text := "```" + chunk + "```"
+		if i == 0 {
+			text = "Here is everything Forge holds about you:\n" + text
+		}
+		if err := sendDirectMessage(ctx, slackID, text); err != nil {
+			return err
+		}
+	}
+	if responseURL == "" {
+		return nil
+	}
+	return respondOrDMText(ctx, slackID, responseURL, "I've sent you a DM with your data.")
+}
+
+// ConfirmPrivacyDelete asks the member to confirm before their data is erased
+func ConfirmPrivacyDelete(ctx context.Context, slackID string, responseURL string) error {
+	msg, err := renderMessage("privacy_delete_confirm", tmplPrivacyDeleteConfirm, struct{ UserID string }{slackID})
+	if err != nil {
+		rlog.Error("Error rendering privacy delete confirmation", "err", err)
+		return err
+	}
+	return respondOrDM(ctx, responseURL, msg)
+}
+
+// ErasePrivacyData revokes the member's linked accounts and erases their personal data
+func ErasePrivacyData(ctx context.Context, slackID string, responseURL string) error {
+	for _, c := range accountConnectors {
+		name, err := linkedAccount(ctx, c, slackID)
+		if errors.Is(err, ErrNoLinkedAccount) {
+			continue
+		}
+		if err != nil {
+			rlog.Error("Error checking account link for erasure", "connector", c.Key, "slackID", slackID, "err", err)
+			respondOrDMText(ctx, slackID, responseURL, "Sorry, I couldn't check your "+c.Name+" account so nothing was erased. Please try again later.")
+			return err
+		}
+		err = disableKollaLinkedAccount(ctx, name)
+		if err != nil {
+			rlog.Error("Error revoking account link for erasure", "connector", c.Key, "slackID", slackID, "err", err)
+			respondOrDMText(ctx, slackID, responseURL, "Sorry, I couldn't unlink your "+c.Name+" account so nothing was erased. Please try again later.")
+			return err
+		}
+		credentialProvider().Forget(c.KollaConnector, memberConsumerID(workspaceFrom(ctx), slackID))
+	}
+
+	_, err := data.ErasePersonData(ctx, slackID, &data.PersonLookupParams{Tenant: workspaceFrom(ctx).Tenant})
+	if err != nil {
+		rlog.Error("Error erasing personal data", "slackID", slackID, "err", err)
+		respondOrDMText(ctx, slackID, responseURL, "Sorry, erasing your data didn't finish. Please try again later.")
+		return err
+	}
+	return respondOrDMText(ctx, slackID, responseURL, "Your personal data has been erased from Forge and your linked accounts were unlinked. Your Slack account isn't affected.")
+}
+
+// chunkLines splits s into pieces of at most max characters, breaking between lines where it can
+func chunkLines(s string, max int) []string {
+	chunks := []string{}
+	var b strings.Builder
+	for _, line := range strings.SplitAfter(s, "\n") {
+		for len(line) > max {
+			if b.Len() > 0 {
+				chunks = append(chunks, b.String())
+				b.Reset()
+			}
+			chunks = append(chunks, line[:max])
+			line = line[max:]
+		}
+		if b.Len()+len(line) > max {
+			chunks = append(chunks, b.String())
+			b.Reset()
+		}
+		b.WriteString(line)
+	}
+	if b.Len() > 0 {
+		chunks = append(chunks, b.String())
+	}
+	return chunks
+}
+
+// Erasure confirmation, slack asks once more before the delete button is sent
+const tmplPrivacyDeleteConfirm = `{
+    "channel": "{{.UserID}}",
+    "text": "Erase your data from Forge?",
+    "response_type": "ephemeral",
+    "replace_original": true,
+    "blocks": [
+        {
+            "type": "section",
+            "text": {
+                "type": "mrkdwn",
+                "text": "This erases your Forge profile, your job posts and unlinks any accounts you linked. It can't be undone."
+            }
+        },
+        {
+            "type": "actions",
+            "elements": [
+                {
+                    "type": "button",
+                    "action_id": "privacy_delete_confirm",
+                    "style": "danger",
+                    "text": {
+                        "type": "plain_text",
+                        "text": "Erase my data",
+                        "emoji": true
+                    },
+                    "confirm": {
+                        "title": {
+                            "type": "plain_text",
+                            "text": "Are you sure?"
+                        },
+                        "text": {
+                            "type": "plain_text",
+                            "text": "Your Forge data will be erased for good."
+                        },
+                        "confirm": {
+                            "type": "plain_text",
+                            "text": "Erase"
+                        },
+                        "deny": {
+                            "type": "plain_text",
+                            "text": "Keep it"
+                        }
+                    }
+                },
+                {
+                    "type": "button",
+                    "action_id": "privacy_delete_cancel",
+                    "text": {
+                        "type": "plain_text",
+                        "text": "Cancel",
+                        "emoji": true
+                    }
+                }
+            ]
+        }
+    ]
+}`
@@ -0,0 +1,75 @@
+package slack
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"encore.app/data"
+)
+
+func TestChunkLines(t *testing.T) {
+	s := "{\n  \"a\": 1,\n  \"b\": 2\n}"
+	chunks := chunkLines(s, 12)
+	if strings.Join(chunks, "") != s {
+		t.Fatalf("chunks %q don't add up to the input", chunks)
+	}
+	for _, c := range chunks {
+		if len(c) > 12 {
+			t.Errorf("chunk %q is over the limit", c)
+		}
+	}
+	if chunks[0] != "{\n  \"a\": 1,\n" {
+		t.Errorf("expected the first chunk to end at a line break, got %q", chunks[0])
+	}
+
+	long := strings.Repeat("x", 25)
+	if got := chunkLines(long, 10); len(got) != 3 || got[2] != "xxxxx" {
+		t.Errorf("a long line should be split hard, got %q", got)
+	}
+}
+
+func TestErasedPeopleArentResynced(t *testing.T) {
+	p := &data.Person{}
+	p.Attributes.SlackID = "UC81JHDJ6"
+	p.Attributes.ErasedAt = "2023-03-01T12:00:00Z"
+	u := SlackUser{ID: "UC81JHDJ6", Name: "soypete"}
+	u.Profile.Email = "pete@example.com"
+
+	if update := slackUserChange(p, u); update != nil {
+		t.Errorf("expected no update for an erased member, got %+v", update)
+	}
+}
+
+func TestConfirmPrivacyDeleteAsksFirst(t *testing.T) {
+	f := newFakeSlack(t)
+
+	err := ConfirmPrivacyDelete(context.Background(), "UC81JHDJ6", "https://hooks.slack.test/respond")
+	if err != nil {
+		t.Fatal(err)
+	}
+	responses := f.responses["https://hooks.slack.test/respond"]
+	if len(responses) != 1 {
+		t.Fatalf("expected a single response, got %v", f.responses)
+	}
+	blocks := []struct {
+		Elements []struct {
+			ActionID string          `json:"action_id"`
+			Confirm  json.RawMessage `json:"confirm"`
+		} `json:"elements"`
+	}{}
+	if err := json.Unmarshal(responses[0].Blocks, &blocks); err != nil {
+		t.Fatal(err)
+	}
+	if len(blocks) != 2 || len(blocks[1].Elements) != 2 {
+		t.Fatalf("unexpected blocks %s", responses[0].Blocks)
+	}
+	erase := blocks[1].Elements[0]
+	if erase.ActionID != "privacy_delete_confirm" || len(erase.Confirm) == 0 {
+		t.Errorf("expected the erase button to ask for confirmation, got %+v", erase)
+	}
+	if responses[0].ResponseType != "ephemeral" {
+		t.Errorf("expected the confirmation to be ephemeral, got %q", responses[0].ResponseType)
+	}
+}
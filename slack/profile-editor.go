@@ -0,0 +1,274 @@
+package slack
+
+import (
+	"context"
+	"encoding/json"
+	"regexp"
+	"strings"
+
+	"encore.app/data"
+	"encore.dev/beta/errs"
+	"encore.dev/rlog"
+	"github.com/tidwall/gjson"
+)
+
+// GitHub usernames are alphanumeric with single hyphens, no leading or trailing hyphen, max 39 chars
+var githubUserPattern = regexp.MustCompile(`^[A-Za-z0-9]+(-[A-Za-z0-9]+)*$`)
+
+// Twitter handles are letters, numbers and underscores, max 15 chars
+var twitterHandlePattern = regexp.MustCompile(`^[A-Za-z0-9_]{1,15}$`)
+
+// OpenProfileEditor sends the Forge profile modal to the person that ran the shortcut or clicked the App Home button.
+// The trigger id is only good for 3 seconds, so a loading modal is opened straight away and filled in once the
+// person is loaded.
+func OpenProfileEditor(ctx context.Context, triggerID string, slackID string) error {
+	opened, err := slackClient.ViewsOpen(ctx, triggerID, json.RawMessage(tmplProfileEditLoading))
+	if err != nil {
+		rlog.Error("Error opening Profile Edit Form", "err", err)
+		return err
+	}
+
+	p, err := loadOrSyncPerson(ctx, slackID)
+	if err != nil {
+		rlog.Error("Error loading person for profile editor", "err", err)
+		slackClient.ViewsUpdate(ctx, opened.ID, opened.Hash, json.RawMessage(tmplProfileEditUnavailable))
+		return err
+	}
+
+	data := struct {
+		Bio           string
+		GithubUser    string
+		TwitterHandle string
+	}{p.Attributes.Bio, p.Attributes.GithubUser, p.Attributes.TwitterHandle}
+	view, err := renderJSON("profile_edit_form", tmplProfileEditForm, data)
+	if err != nil {
+		rlog.Error("Error rendering Profile Edit Form", "err", err)
+		slackClient.ViewsUpdate(ctx, opened.ID, opened.Hash, json.RawMessage(tmplProfileEditUnavailable))
+		return err
+	}
+
+	// The hash makes slack refuse the update if the member already closed or changed the modal
+	err = slackClient.ViewsUpdate(ctx, opened.ID, opened.Hash, view)
+	if err != nil {
+		rlog.Error("Error sending Profile Edit Form", "err", err)
+		return err
+	}
+
+	return nil
+}
+
+// ProfileEdit is what a member submitted in the profile modal
+type ProfileEdit struct {
+	SlackID       string
+	Bio           string
+	GithubUser    string
+	TwitterHandle string
+}
+
+// ProfileEditSubmit reads and validates the submitted profile form, it makes no calls so slack gets its answer
+// in time. Validation failures are returned as a map of block_id to message so slack can show them inline.
+func ProfileEditSubmit(payload string) (*ProfileEdit, map[string]string) {
+	edit := &ProfileEdit{
+		SlackID:       gjson.Get(payload, "user.id").Str,
+		Bio:           strings.TrimSpace(gjson.Get(payload, "view.state.values.bio.bio.value").Str),
+		GithubUser:    normalizeHandle(gjson.Get(payload, "view.state.values.github.github_user.value").Str),
+		TwitterHandle: normalizeHandle(gjson.Get(payload, "view.state.values.twitter.twitter_handle.value").Str),
+	}
+	return edit, validateProfile(edit.GithubUser, edit.TwitterHandle)
+}
+
+// SaveProfileEdit saves a validated profile edit to the Forge Data API. Slack has closed the modal by then,
+// so the member is told by DM when it doesn't work out.
+func SaveProfileEdit(ctx context.Context, edit *ProfileEdit) error {
+	p, err := loadOrSyncPerson(ctx, edit.SlackID)
+	if err == nil {
+		p, err = updatePersonWithRetry(ctx, p, func(*data.Person) *data.PersonUpdate {
+			return &data.PersonUpdate{
+				Bio:           &edit.Bio,
+				GithubUser:    &edit.GithubUser,
+				TwitterHandle: &edit.TwitterHandle,
+			}
+		})
+	}
+	if err != nil {
+		rlog.Error("Error saving forge profile", "slackID", edit.SlackID, "err", err)
+		sendDirectMessage(ctx, edit.SlackID, "Sorry, I couldn't save your Forge profile. Please try again later.")
+		return err
+	}
+
+	trackOnboardingProgress(ctx, p)
+
+	return nil
+}
+
+// validateProfile checks the handle formats, the returned map is keyed by the form block_id
+func validateProfile(githubUser string, twitterHandle string) map[string]string {
+	validationErrors := map[string]string{}
+	if githubUser != "" && (len(githubUser) > 39 || !githubUserPattern.MatchString(githubUser)) {
+		validationErrors["github"] = "GitHub usernames may only contain letters, numbers and single hyphens, and can't start or end with a hyphen."
+	}
+	if twitterHandle != "" && !twitterHandlePattern.MatchString(twitterHandle) {
+		validationErrors["twitter"] = "Twitter handles are up to 15 letters, numbers or underscores."
+	}
+	return validationErrors
+}
+
+// normalizeHandle strips whitespace and a leading @ that people tend to type
+func normalizeHandle(handle string) string {
+	return strings.TrimPrefix(strings.TrimSpace(handle), "@")
+}
+
+// loadOrSyncPerson loads the person for a slack user, creating the record from slack if it doesn't exist yet
+func loadOrSyncPerson(ctx context.Context, slackID string) (*data.Person, error) {
+	p, err := loadPersonBySlackID(ctx, slackID)
+	if err != nil {
+		e, ok := err.(*errs.Error)
+		if !ok || e.Code != errs.NotFound {
+			return nil, err
+		}
+		return SyncSlackUserToDataApi(ctx, slackID)
+	}
+	return p, nil
+}
+
+// jsonString encodes a string as a quoted JSON value for use inside templates
+func jsonString(s string) string {
+	b, _ := json.Marshal(s)
+	return string(b)
+}
+
+// Shown while the member's profile loads
+const tmplProfileEditLoading = `{
+    "type": "modal",
+    "callback_id": "profile_edit_loading",
+    "title": {
+        "type": "plain_text",
+        "text": "Forge Profile",
+        "emoji": true
+    },
+    "close": {
+        "type": "plain_text",
+        "text": "Cancel",
+        "emoji": true
+    },
+    "blocks": [
+        {
+            "type": "section",
+            "text": {
+                "type": "mrkdwn",
+                "text": ":hourglass_flowing_sand: Loading your profile..."
+            }
+        }
+    ]
+}`
+
+// Replaces the loading modal when the profile couldn't be loaded
+const tmplProfileEditUnavailable = `{
+    "type": "modal",
+    "callback_id": "profile_edit_loading",
+    "title": {
+        "type": "plain_text",
+        "text": "Forge Profile",
+        "emoji": true
+    },
+    "close": {
+        "type": "plain_text",
+        "text": "Close",
+        "emoji": true
+    },
+    "blocks": [
+        {
+            "type": "section",
+            "text": {
+                "type": "mrkdwn",
+                "text": "Sorry, I couldn't load your profile. Please try again later."
+            }
+        }
+    ]
+}`
+
+// Forge Profile Slack Modal/Form
+const tmplProfileEditForm = `{
+    "type": "modal",
+    "callback_id": "profile_edit_submit",
+    "title": {
+        "type": "plain_text",
+        "text": "Forge Profile",
+        "emoji": true
+    },
+    "submit": {
+        "type": "plain_text",
+        "text": "Save",
+        "emoji": true
+    },
+    "close": {
+        "type": "plain_text",
+        "text": "Cancel",
+        "emoji": true
+    },
+    "blocks": [
+        {
+            "type": "section",
+            "text": {
+                "type": "mrkdwn",
+                "text": "Tell the Forge Utah community a little about yourself"
+            }
+        },
+        {
+            "type": "divider"
+        },
+        {
+            "type": "input",
+            "block_id": "bio",
+            "optional": true,
+            "element": {
+                "type": "plain_text_input",
+                "multiline": true,
+                "max_length": 500,
+                {{- if .Bio}}
+                "initial_value": {{json .Bio}},
+                {{- end}}
+                "action_id": "bio"
+            },
+            "label": {
+                "type": "plain_text",
+                "text": "Bio",
+                "emoji": true
+            }
+        },
+        {
+            "type": "input",
+            "block_id": "github",
+            "optional": true,
+            "element": {
+                "type": "plain_text_input",
+                {{- if .GithubUser}}
+                "initial_value": {{json .GithubUser}},
+                {{- end}}
+                "action_id": "github_user"
+            },
+            "label": {
+                "type": "plain_text",
+                "text": "GitHub Username",
+                "emoji": true
+            }
+        },
+        {
+            "type": "input",
+            "block_id": "twitter",
+            "optional": true,
+            "element": {
+                "type": "plain_text_input",
+                {{- if .TwitterHandle}}
+                "initial_value": {{json .TwitterHandle}},
+                {{- end}}
+                "action_id": "twitter_handle"
+            },
+            "label": {
+                "type": "plain_text",
+                "text": "Twitter Handle",
+                "emoji": true
+            }
+        }
+    ]
+}`
@@ -0,0 +1,146 @@
+package slack
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+
+	"encore.app/data"
+	"encore.dev/rlog"
+)
+
+// SlackProfileField is the value of a workspace custom profile field
+type SlackProfileField struct {
+	Value string `json:"value"`
+	Alt   string `json:"alt"`
+}
+
+// SlackProfileFields is keyed by custom field id. It is nil when the api didn't return the fields
+// (users.list leaves them out) and empty when the member hasn't filled any in.
+type SlackProfileFields map[string]SlackProfileField
+
+// UnmarshalJSON accepts the empty array slack sends for profiles without custom fields
+func (f *SlackProfileFields) UnmarshalJSON(b []byte) error {
+	if bytes.HasPrefix(bytes.TrimSpace(b), []byte("[")) {
+		*f = SlackProfileFields{}
+		return nil
+	}
+	var fields map[string]SlackProfileField
+	if err := json.Unmarshal(b, &fields); err != nil {
+		return err
+	}
+	*f = fields
+	return nil
+}
+
+// Which side wins when slack and the forge profile both have a value and they differ. Forge is read-only toward
+// slack, the bot token can't set other members' profiles, so an edit made in the forge profile editor only sticks
+// while forge is preferred.
+const (
+	preferSlack = "slack"
+	preferForge = "forge"
+)
+
+// profileFieldMapping maps slack custom profile field ids to person attributes. Values only flow from slack to
+// forge. It is read from the SlackProfileFieldMapping secret, for example:
+//
+//	{"fields": {"Xf01GITHUB": "github_user", "Xf02TWITTER": "twitter_handle", "Xf03BIO": "bio"}, "prefer": "forge"}
+type profileFieldMapping struct {
+	Fields map[string]string `json:"fields"`
+	Prefer string            `json:"prefer"`
+}
+
+// loadProfileFieldMapping parses the mapping secret, an unset or broken secret maps nothing
+func loadProfileFieldMapping() profileFieldMapping {
+	m := profileFieldMapping{}
+	if secrets.SlackProfileFieldMapping == "" {
+		return m
+	}
+	err := json.Unmarshal([]byte(secrets.SlackProfileFieldMapping), &m)
+	if err != nil {
+		rlog.Error("Error parsing SlackProfileFieldMapping secret", "err", err)
+		return profileFieldMapping{}
+	}
+	for fieldID, attr := range m.Fields {
+		if !isMappableAttribute(attr) {
+			rlog.Error("Ignoring slack profile field mapped to unknown person attribute", "field", fieldID, "attribute", attr)
+			delete(m.Fields, fieldID)
+		}
+	}
+	return m
+}
+
+// profileFieldChanges sets the mapped attributes slack should change on the person and reports whether it set any.
+// Empty slack values never clear a forge value, and when both sides differ m.Prefer decides. Forge is preferred by
+// default so a change made in the profile editor isn't undone by the next slack profile event.
+func profileFieldChanges(update *data.PersonUpdate, existing *data.Person, u SlackUser, m profileFieldMapping) bool {
+	if u.Profile.Fields == nil {
+		return false
+	}
+	changed := false
+	for fieldID, attr := range m.Fields {
+		slackValue := normalizeProfileValue(attr, u.Profile.Fields[fieldID].Value)
+		forgeValue := ""
+		if existing != nil {
+			forgeValue = personAttribute(existing, attr)
+		}
+		if slackValue == "" || slackValue == forgeValue {
+			continue
+		}
+		if forgeValue != "" && m.Prefer != preferSlack {
+			continue
+		}
+		setPersonAttribute(update, attr, slackValue)
+		changed = true
+	}
+	return changed
+}
+
+// loadSlackProfileFields fetches the member's custom profile fields, users.info doesn't include them
+func loadSlackProfileFields(ctx context.Context, slackID string) (SlackProfileFields, error) {
+	fields, err := slackClient.UsersProfileGet(ctx, slackID)
+	if err != nil {
+		rlog.Error("Error loading slack profile fields", "err", err)
+		return nil, err
+	}
+	return fields, nil
+}
+
+func isMappableAttribute(attr string) bool {
+	switch attr {
+	case "bio", "github_user", "twitter_handle":
+		return true
+	}
+	return false
+}
+
+func personAttribute(p *data.Person, attr string) string {
+	switch attr {
+	case "bio":
+		return p.Attributes.Bio
+	case "github_user":
+		return p.Attributes.GithubUser
+	case "twitter_handle":
+		return p.Attributes.TwitterHandle
+	}
+	return ""
+}
+
+func setPersonAttribute(u *data.PersonUpdate, attr string, value string) {
+	switch attr {
+	case "bio":
+		u.Bio = &value
+	case "github_user":
+		u.GithubUser = &value
+	case "twitter_handle":
+		u.TwitterHandle = &value
+	}
+}
+
+// normalizeProfileValue tidies a slack field value the same way the profile editor tidies its input
+func normalizeProfileValue(attr string, value string) string {
+	if attr == "github_user" || attr == "twitter_handle" {
+		return normalizeHandle(value)
+	}
+	return value
+}
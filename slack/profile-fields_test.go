@@ -0,0 +1,80 @@
+package slack
+
+import (
+	"encoding/json"
+	"testing"
+
+	"encore.app/data"
+)
+
+var testMapping = profileFieldMapping{
+	Fields: map[string]string{"Xf01GITHUB": "github_user", "Xf02TWITTER": "twitter_handle"},
+}
+
+func slackUserWithFields(fields SlackProfileFields) SlackUser {
+	u := SlackUser{ID: "UC81JHDJ6"}
+	u.Profile.Fields = fields
+	return u
+}
+
+func TestProfileFieldChangesFillsEmptyForgeValues(t *testing.T) {
+	u := slackUserWithFields(SlackProfileFields{"Xf01GITHUB": {Value: "@clint"}})
+
+	update := &data.PersonUpdate{}
+	if !profileFieldChanges(update, &data.Person{}, u, testMapping) {
+		t.Fatal("profileFieldChanges made no change, expected github_user from slack")
+	}
+	if update.GithubUser == nil || *update.GithubUser != "clint" || update.TwitterHandle != nil {
+		t.Errorf("profileFieldChanges = %+v, expected only github_user clint", update)
+	}
+}
+
+func TestProfileFieldChangesConflicts(t *testing.T) {
+	existing := &data.Person{}
+	existing.Attributes.GithubUser = "clint-forge"
+	u := slackUserWithFields(SlackProfileFields{"Xf01GITHUB": {Value: "clint-slack"}})
+
+	update := &data.PersonUpdate{}
+	if profileFieldChanges(update, existing, u, testMapping) {
+		t.Errorf("by default profileFieldChanges = %+v, expected the forge value to be kept", update)
+	}
+
+	preferSlackMapping := testMapping
+	preferSlackMapping.Prefer = preferSlack
+	update = &data.PersonUpdate{}
+	if !profileFieldChanges(update, existing, u, preferSlackMapping) || *update.GithubUser != "clint-slack" {
+		t.Errorf("with slack preferred profileFieldChanges = %+v, expected the slack value", update)
+	}
+}
+
+func TestProfileFieldChangesNeverClearsForgeValues(t *testing.T) {
+	existing := &data.Person{}
+	existing.Attributes.TwitterHandle = "clint_tweets"
+
+	for _, u := range []SlackUser{
+		slackUserWithFields(SlackProfileFields{}),
+		slackUserWithFields(nil),
+	} {
+		update := &data.PersonUpdate{}
+		if profileFieldChanges(update, existing, u, testMapping) {
+			t.Errorf("profileFieldChanges(%v) = %+v, expected no change", u.Profile.Fields, update)
+		}
+	}
+}
+
+func TestSlackProfileFieldsUnmarshal(t *testing.T) {
+	var profile struct {
+		Fields SlackProfileFields `json:"fields"`
+	}
+	for in, wantLen := range map[string]int{
+		`{"fields": []}`: 0,
+		`{"fields": {"Xf01GITHUB": {"value": "clint", "alt": ""}}}`: 1,
+	} {
+		if err := json.Unmarshal([]byte(in), &profile); err != nil {
+			t.Fatalf("json.Unmarshal(%s): %v", in, err)
+		}
+		if profile.Fields == nil || len(profile.Fields) != wantLen {
+			t.Errorf("json.Unmarshal(%s) fields = %v, expected %d fields", in, profile.Fields, wantLen)
+		}
+	}
+}
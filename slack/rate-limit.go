@@ -0,0 +1,215 @@
+package slack
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"encore.app/data"
+)
+
+// Requests per minute slack allows for each rate limit tier, see https://api.slack.com/docs/rate-limits
+const (
+	tier1 = 1
+	tier2 = 20
+	tier3 = 50
+	tier4 = 100
+	// chat.postMessage isn't tiered, slack allows about one message per second
+	tierPostMessage = 60
+)
+
+// methodTiers is the documented tier of each method we call, anything missing is treated as tier 3
+var methodTiers = map[string]int{
+	"views.open":            tier4,
+	"views.update":          tier4,
+	"views.publish":         tier4,
+	"chat.postMessage":      tierPostMessage,
+	"chat.update":           tier3,
+	"users.info":            tier4,
+	"users.list":            tier2,
+	"users.profile.get":     tier4,
+	"conversations.open":    tier3,
+	"usergroups.users.list": tier2,
+}
+
+// A bucket holds this many seconds worth of requests so short bursts go out right away
+const rateLimitBurstSeconds = 10
+
+// How many times a background call is retried after slack answers 429
+const rateLimitRetries = 5
+
+type backgroundKey struct{}
+
+// withBackgroundPriority marks slack calls made with ctx as background work. Background calls wait for
+// the rate limit, calls on behalf of someone waiting in slack fail fast instead.
+func withBackgroundPriority(ctx context.Context) context.Context {
+	return context.WithValue(ctx, backgroundKey{}, true)
+}
+
+func isBackground(ctx context.Context) bool {
+	background, _ := ctx.Value(backgroundKey{}).(bool)
+	return background
+}
+
+// rateLimiter keeps a token bucket per workspace and slack method, slack limits each workspace's token separately
+type rateLimiter struct {
+	now func() time.Time
+
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+}
+
+type tokenBucket struct {
+	tokens    float64
+	capacity  float64
+	perSecond float64
+	updated   time.Time
+	// blockedUntil is set from Retry-After when slack rate limited us anyway
+	blockedUntil time.Time
+}
+
+func newRateLimiter() *rateLimiter {
+	return &rateLimiter{now: time.Now, buckets: map[string]*tokenBucket{}}
+}
+
+// bucketKey is the bucket for calls to method made with ctx
+func bucketKey(ctx context.Context, method string) string {
+	return workspaceFrom(ctx).TeamID + "/" + method
+}
+
+func (l *rateLimiter) bucket(key string, method string, now time.Time) *tokenBucket {
+	b, ok := l.buckets[key]
+	if !ok {
+		perMinute, ok := methodTiers[method]
+		if !ok {
+			perMinute = tier3
+		}
+		perSecond := float64(perMinute) / 60
+		capacity := perSecond * rateLimitBurstSeconds
+		if capacity < 1 {
+			capacity = 1
+		}
+		b = &tokenBucket{tokens: capacity, capacity: capacity, perSecond: perSecond, updated: now}
+		l.buckets[key] = b
+	}
+	b.tokens += now.Sub(b.updated).Seconds() * b.perSecond
+	if b.tokens > b.capacity {
+		b.tokens = b.capacity
+	}
+	b.updated = now
+	return b
+}
+
+// reserve takes a token for method and returns how long to wait before using it. Interactive callers
+// don't get a token when they would have to wait, they get a rate limit error instead.
+func (l *rateLimiter) reserve(ctx context.Context, method string) (time.Duration, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	b := l.bucket(bucketKey(ctx, method), method, now)
+
+	var wait time.Duration
+	if b.tokens < 1 {
+		wait = time.Duration((1 - b.tokens) / b.perSecond * float64(time.Second))
+	}
+	if blocked := b.blockedUntil.Sub(now); blocked > wait {
+		wait = blocked
+	}
+	if wait > 0 && !isBackground(ctx) {
+		rateLimitStats.record(method, func(s *RateLimitStats) { s.Rejected++ })
+		return wait, &APIError{Method: method, Code: "ratelimited", RetryAfter: wait}
+	}
+
+	b.tokens--
+	if wait > 0 {
+		rateLimitStats.record(method, func(s *RateLimitStats) { s.Queued++ })
+	}
+	return wait, nil
+}
+
+// acquire waits until method may be called
+func (l *rateLimiter) acquire(ctx context.Context, method string) error {
+	wait, err := l.reserve(ctx, method)
+	if err != nil || wait == 0 {
+		return err
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		// Give the token back for whoever is queued behind us
+		l.mu.Lock()
+		l.buckets[bucketKey(ctx, method)].tokens++
+		l.mu.Unlock()
+		return ctx.Err()
+	}
+}
+
+// backoff holds every call to method until slack's Retry-After has passed
+func (l *rateLimiter) backoff(ctx context.Context, method string, retryAfter time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	b := l.bucket(bucketKey(ctx, method), method, now)
+	if until := now.Add(retryAfter); until.After(b.blockedUntil) {
+		b.blockedUntil = until
+	}
+	rateLimitStats.record(method, func(s *RateLimitStats) { s.Throttled++ })
+}
+
+// RateLimitStats counts throttling events for a slack method since the service started
+type RateLimitStats struct {
+	Method string
+	// Throttled is how often slack answered 429
+	Throttled int
+	// Queued is how often a background call waited for the rate limit
+	Queued int
+	// Rejected is how often an interactive call failed fast instead of waiting
+	Rejected int
+}
+
+// rateLimitStats is kept in memory, encore v1.12 has no metrics package to report them to
+var rateLimitStats = &throttleStats{methods: map[string]*RateLimitStats{}}
+
+type throttleStats struct {
+	mu      sync.Mutex
+	methods map[string]*RateLimitStats
+}
+
+func (t *throttleStats) record(method string, update func(s *RateLimitStats)) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	s, ok := t.methods[method]
+	if !ok {
+		s = &RateLimitStats{Method: method}
+		t.methods[method] = s
+	}
+	update(s)
+}
+
+func (t *throttleStats) snapshot() []RateLimitStats {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	ret := []RateLimitStats{}
+	for _, s := range t.methods {
+		ret = append(ret, *s)
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].Method < ret[j].Method })
+	return ret
+}
+
+type RateLimitReport struct {
+	Methods []RateLimitStats
+}
+
+// RateLimits shows organizers how often the service has been throttled by slack
+// encore:api auth path=/slack/rate-limits
+func RateLimits(ctx context.Context) (*RateLimitReport, error) {
+	if err := data.RequireOrganizer(); err != nil {
+		return nil, err
+	}
+	return &RateLimitReport{Methods: rateLimitStats.snapshot()}, nil
+}
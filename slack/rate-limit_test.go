@@ -0,0 +1,98 @@
+package slack
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestInteractiveCallsFailFastWhenLimited(t *testing.T) {
+	now := time.Date(2023, 3, 1, 12, 0, 0, 0, time.UTC)
+	l := newRateLimiter()
+	l.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	// users.list is tier 2, 20 a minute with a 10 second burst
+	for i := 0; i < 3; i++ {
+		if wait, err := l.reserve(ctx, "users.list"); err != nil || wait != 0 {
+			t.Fatalf("call %d within the burst waited %s: %v", i, wait, err)
+		}
+	}
+	_, err := l.reserve(ctx, "users.list")
+	if !errors.Is(err, ErrRateLimited) {
+		t.Fatalf("expected an interactive call past the burst to fail fast, got %v", err)
+	}
+
+	// Other methods have their own bucket
+	if wait, err := l.reserve(ctx, "users.info"); err != nil || wait != 0 {
+		t.Fatalf("users.info was limited by users.list: %s %v", wait, err)
+	}
+
+	now = now.Add(3 * time.Second)
+	if _, err := l.reserve(ctx, "users.list"); err != nil {
+		t.Fatalf("expected the bucket to refill, got %v", err)
+	}
+}
+
+func TestBackgroundCallsQueue(t *testing.T) {
+	now := time.Date(2023, 3, 1, 12, 0, 0, 0, time.UTC)
+	l := newRateLimiter()
+	l.now = func() time.Time { return now }
+	ctx := withBackgroundPriority(context.Background())
+
+	// chat.postMessage allows one a second with a burst of 10
+	for i := 0; i < 10; i++ {
+		l.reserve(ctx, "chat.postMessage")
+	}
+	first, err := l.reserve(ctx, "chat.postMessage")
+	if err != nil || first != time.Second {
+		t.Fatalf("expected the first queued call to wait 1s, got %s %v", first, err)
+	}
+	second, _ := l.reserve(ctx, "chat.postMessage")
+	if second != 2*time.Second {
+		t.Fatalf("expected the next queued call to wait behind it, got %s", second)
+	}
+}
+
+func TestRetryAfterBlocksMethod(t *testing.T) {
+	now := time.Date(2023, 3, 1, 12, 0, 0, 0, time.UTC)
+	l := newRateLimiter()
+	l.now = func() time.Time { return now }
+
+	l.backoff(context.Background(), "chat.postMessage", 30*time.Second)
+
+	_, err := l.reserve(context.Background(), "chat.postMessage")
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.RetryAfter != 30*time.Second {
+		t.Fatalf("expected interactive calls to be told to retry after 30s, got %v", err)
+	}
+	wait, err := l.reserve(withBackgroundPriority(context.Background()), "chat.postMessage")
+	if err != nil || wait != 30*time.Second {
+		t.Fatalf("expected background calls to wait out Retry-After, got %s %v", wait, err)
+	}
+
+	now = now.Add(31 * time.Second)
+	if wait, err := l.reserve(context.Background(), "chat.postMessage"); err != nil || wait != 0 {
+		t.Fatalf("expected calls to go through after Retry-After, got %s %v", wait, err)
+	}
+}
+
+func TestWorkspacesHaveTheirOwnLimits(t *testing.T) {
+	forge, other := useTwoWorkspaces(t)
+	now := time.Date(2023, 3, 1, 12, 0, 0, 0, time.UTC)
+	l := newRateLimiter()
+	l.now = func() time.Time { return now }
+	forgeCtx := withWorkspace(context.Background(), forge)
+	otherCtx := withWorkspace(context.Background(), other)
+
+	for i := 0; i < 3; i++ {
+		l.reserve(forgeCtx, "users.list")
+	}
+	if _, err := l.reserve(forgeCtx, "users.list"); !errors.Is(err, ErrRateLimited) {
+		t.Fatalf("expected the forge workspace to be limited, got %v", err)
+	}
+	if wait, err := l.reserve(otherCtx, "users.list"); err != nil || wait != 0 {
+		t.Fatalf("other workspace was limited by forge's calls: %s %v", wait, err)
+	}
+}
@@ -0,0 +1,61 @@
+package slack
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+
+	"encore.dev/rlog"
+)
+
+// Slack request signatures older than this are rejected so a captured request can't be replayed
+const slackSignatureTolerance = 5 * time.Minute
+
+// readSignedSlackRequest reads the body of a request to one of the slack endpoints and checks slack signed it.
+// Unsigned requests get a 401 and ok is false. The body is put back so form requests can still be parsed.
+func readSignedSlackRequest(w http.ResponseWriter, r *http.Request) (body []byte, ok bool) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		rlog.Error("Error reading slack request body", "err", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return nil, false
+	}
+	err = verifySlackSignature(secrets.SlackSigningSecret, r.Header.Get("X-Slack-Request-Timestamp"), r.Header.Get("X-Slack-Signature"), body, time.Now())
+	if err != nil {
+		rlog.Error("Rejected slack request", "path", r.URL.Path, "err", err)
+		w.WriteHeader(http.StatusUnauthorized)
+		return nil, false
+	}
+	r.Body = ioutil.NopCloser(bytes.NewReader(body))
+	return body, true
+}
+
+// verifySlackSignature checks the v0 signature slack sends, "v0=" and the hex HMAC-SHA256 of "v0:<timestamp>:<body>"
+func verifySlackSignature(secret string, timestamp string, signature string, body []byte, now time.Time) error {
+	if secret == "" {
+		return fmt.Errorf("slack signing secret is not set")
+	}
+	unix, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return fmt.Errorf("bad signature timestamp %q", timestamp)
+	}
+	age := now.Sub(time.Unix(unix, 0))
+	if age > slackSignatureTolerance || age < -slackSignatureTolerance {
+		return fmt.Errorf("signature timestamp %s is outside the tolerance", time.Unix(unix, 0))
+	}
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("v0:" + timestamp + ":"))
+	mac.Write(body)
+	expected := "v0=" + hex.EncodeToString(mac.Sum(nil))
+	if !hmac.Equal([]byte(expected), []byte(signature)) {
+		return fmt.Errorf("signature mismatch")
+	}
+	return nil
+}
@@ -0,0 +1,47 @@
+package slack
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func signSlack(secret string, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("v0:" + timestamp + ":"))
+	mac.Write(body)
+	return "v0=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestVerifySlackSignature(t *testing.T) {
+	const secret = "8f742231b10e8888abcd99yyyzzz85a5"
+	body := []byte(`payload=%7B%22type%22%3A%22block_actions%22%2C%22user%22%3A%7B%22id%22%3A%22UC81JHDJ6%22%7D%7D`)
+	now := time.Unix(1687305600, 0)
+	ts := strconv.FormatInt(now.Unix(), 10)
+	stale := strconv.FormatInt(now.Add(-time.Hour).Unix(), 10)
+
+	tests := []struct {
+		name      string
+		secret    string
+		timestamp string
+		signature string
+		body      []byte
+		wantErr   bool
+	}{
+		{"valid", secret, ts, signSlack(secret, ts, body), body, false},
+		{"wrong secret", secret, ts, signSlack("other", ts, body), body, true},
+		{"tampered body", secret, ts, signSlack(secret, ts, body), []byte(`payload=%7B%22user%22%3A%7B%22id%22%3A%22U0EVIL%22%7D%7D`), true},
+		{"stale timestamp", secret, stale, signSlack(secret, stale, body), body, true},
+		{"unsigned", secret, "", "", body, true},
+		{"no secret configured", "", ts, signSlack("", ts, body), body, true},
+	}
+	for _, tt := range tests {
+		err := verifySlackSignature(tt.secret, tt.timestamp, tt.signature, tt.body, now)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: verifySlackSignature() = %v, wantErr %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
@@ -2,16 +2,11 @@ package slack
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
-	"io/ioutil"
-	"log"
-	"net/http"
 
 	"encore.app/data"
 	"encore.dev/beta/errs"
 	"encore.dev/rlog"
-	"github.com/kollalabs/sdk-go/kc"
 )
 
 // encore:api private  method=GET path=/slack/users/:id/sync
@@ -23,98 +18,118 @@ func SyncSlackUserToDataApi(ctx context.Context, id string) (*data.Person, error
 		return person, fmt.Errorf("couldn't load slack user: %w", err)
 	}
 
-	p, derr := data.LoadUserBySlackID(ctx, id)
-	if derr != nil {
-		e, ok := derr.(*errs.Error)
-		if !ok {
-			rlog.Debug("Error loading user by slack id", "error", derr.Error())
-			return person, derr
-		}
-		if e.Code == errs.NotFound {
-			// Create a new user
-			pReq := &data.Person{}
-			pReq.Attributes.SlackID = slackUser.ID
-			pReq.Attributes.DisplayName = slackUser.Name
-			pReq.Attributes.Email = slackUser.Profile.Email
-
-			p, err = data.CreatePerson(ctx, pReq)
-			rlog.Debug("Person created", p)
-			if err != nil {
-				return person, err
-			}
+	if len(loadProfileFieldMapping().Fields) > 0 {
+		slackUser.Profile.Fields, err = loadSlackProfileFields(ctx, id)
+		if err != nil {
+			return person, fmt.Errorf("couldn't load slack profile fields: %w", err)
 		}
 	}
-	rlog.Debug("Person found or credated", "person", p)
-	cpr := &data.Person{}
-	cpr.Attributes.SlackID = slackUser.ID
-	cpr.Attributes.DisplayName = slackUser.Name
-	cpr.Attributes.Email = slackUser.Profile.Email
-
-	newp, err := data.UpdatePerson(ctx, p.ID, cpr)
-	return newp, nil
-}
 
-// GetSlackUserByID returns a slack user by id
-// encore:api private path=/slack/users/:id
-func GetSlackUserByID(ctx context.Context, id string) (SlackUser, error) {
-	var user SlackUser
-	kolla, err := kc.New(secrets.KollaAPIKey)
+	existing, err := loadPersonBySlackID(ctx, id)
 	if err != nil {
-		rlog.Error("unable to load kolla connect client", "error", err)
-		return user, err
+		if e, ok := err.(*errs.Error); !ok || e.Code != errs.NotFound {
+			return person, err
+		}
+		existing = nil
 	}
-	// Get consumer token
-	creds, err := kolla.Credentials(ctx, "internal-slack", "internal") // Use consumer ID set in consumer token
-	if err != nil {
-		log.Fatalf("unable to load consumer credentials: %s\n", err)
-		return user, err
+
+	update := slackUserChange(existing, slackUser)
+	if update == nil {
+		rlog.Debug("Person already up to date with slack", "person", existing)
+		return existing, nil
 	}
 
-	req, err := http.NewRequest("GET", "https://slack.com/api/users.info?user="+id, nil)
+	p, err := upsertPersonBySlackID(ctx, id, update)
 	if err != nil {
-		rlog.Error("Error creating Job Post Form request", "err", err)
-		return user, err
+		return person, err
 	}
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+creds.Token)
+	rlog.Debug("Person found or created", "person", p)
+	return p, nil
+}
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
+// How many times a person update is reapplied after losing a race with another writer
+const personUpdateAttempts = 3
 
-	if err != nil {
-		rlog.Error("Error sending Job Post Form", "err", err)
-		return user, err
+// updatePersonWithRetry applies change to the person using the version that was read. If another flow updated
+// the person in the meantime the person is re-read and change is reapplied, up to personUpdateAttempts times.
+func updatePersonWithRetry(ctx context.Context, p *data.Person, change func(p *data.Person) *data.PersonUpdate) (*data.Person, error) {
+	for attempt := 1; ; attempt++ {
+		update := change(p)
+		update.Version = p.Attributes.UpdatedAt
+
+		newp, err := data.UpdatePerson(ctx, p.ID, update)
+		if err == nil {
+			return newp, nil
+		}
+		if e, ok := err.(*errs.Error); !ok || e.Code != errs.Aborted || attempt == personUpdateAttempts {
+			return nil, err
+		}
+		rlog.Debug("Person changed while updating, retrying", "id", p.ID, "attempt", attempt)
+
+		// The cache and the mirror may still hold the version that just lost
+		p, err = data.LoadPerson(ctx, p.ID, &data.LoadPersonParams{Fresh: true})
+		if err != nil {
+			return nil, err
+		}
 	}
-	defer resp.Body.Close()
+}
 
-	if resp.StatusCode != http.StatusOK {
-		rlog.Error("Error sending Job Post Form", "status", resp.StatusCode)
-		return user, err
+// personUpdateFromSlack only sets the attributes slack owns so a sync never touches bio, handles or meetup id
+func personUpdateFromSlack(slackUser SlackUser) *data.PersonUpdate {
+	slackID := slackUser.ID
+	displayName := slackUser.Name
+	email := slackUser.Profile.Email
+	inactive := slackUser.Deleted
+	return &data.PersonUpdate{
+		SlackID:     &slackID,
+		DisplayName: &displayName,
+		Email:       &email,
+		Inactive:    &inactive,
 	}
-	// Get response body
-	body, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		rlog.Error("Error reading body from slack api", "err", err)
-		return user, err
+}
+
+// slackUserChange works out what has to be written to keep a person in step with their slack user. It returns nil
+// when the person is already up to date, when a deactivated member never had a person record to begin with, or
+// when the member had their data erased.
+func slackUserChange(existing *data.Person, u SlackUser) *data.PersonUpdate {
+	if existing == nil && u.Deleted {
+		return nil
 	}
-	// decode body to UserProfileResponse
-	userResp := UserProfileResponse{}
-	err = json.Unmarshal(body, &userResp)
-	if err != nil {
-		rlog.Error("Error decoding user profile response", "err", err)
-		return user, err
+	if existing != nil && existing.Attributes.ErasedAt != "" {
+		return nil
+	}
+	update := &data.PersonUpdate{}
+	changed := false
+	if existing == nil || !personMatchesSlack(existing, u) {
+		update = personUpdateFromSlack(u)
+		changed = true
 	}
-	if !userResp.Ok {
-		rlog.Error("Error getting user profile", "err", userResp.Error)
+	if profileFieldChanges(update, existing, u, loadProfileFieldMapping()) {
+		changed = true
 	}
+	if !changed {
+		return nil
+	}
+	return update
+}
 
-	return userResp.User, err
+// personMatchesSlack reports whether the person already has the attributes slack owns
+func personMatchesSlack(p *data.Person, u SlackUser) bool {
+	return p.Attributes.SlackID == u.ID &&
+		p.Attributes.DisplayName == u.Name &&
+		p.Attributes.Email == u.Profile.Email &&
+		p.Attributes.Inactive == u.Deleted
 }
 
-type UserProfileResponse struct {
-	Ok    bool      `json:"ok"`
-	Error string    `json:"error"`
-	User  SlackUser `json:"user"`
+// GetSlackUserByID returns a slack user by id
+// encore:api private path=/slack/users/:id
+func GetSlackUserByID(ctx context.Context, id string) (SlackUser, error) {
+	user, err := slackClient.UsersInfo(ctx, id)
+	if err != nil {
+		rlog.Error("Error getting user profile", "slackID", id, "err", err)
+		return SlackUser{}, err
+	}
+	return *user, nil
 }
 
 type SlackUser struct {
@@ -128,22 +143,23 @@ type SlackUser struct {
 	TzLabel  string `json:"tz_label"`
 	TzOffset int    `json:"tz_offset"`
 	Profile  struct {
-		AvatarHash            string `json:"avatar_hash"`
-		StatusText            string `json:"status_text"`
-		StatusEmoji           string `json:"status_emoji"`
-		RealName              string `json:"real_name"`
-		DisplayName           string `json:"display_name"`
-		RealNameNormalized    string `json:"real_name_normalized"`
-		DisplayNameNormalized string `json:"display_name_normalized"`
-		Email                 string `json:"email"`
-		ImageOriginal         string `json:"image_original"`
-		Image24               string `json:"image_24"`
-		Image32               string `json:"image_32"`
-		Image48               string `json:"image_48"`
-		Image72               string `json:"image_72"`
-		Image192              string `json:"image_192"`
-		Image512              string `json:"image_512"`
-		Team                  string `json:"team"`
+		AvatarHash            string             `json:"avatar_hash"`
+		StatusText            string             `json:"status_text"`
+		StatusEmoji           string             `json:"status_emoji"`
+		RealName              string             `json:"real_name"`
+		DisplayName           string             `json:"display_name"`
+		RealNameNormalized    string             `json:"real_name_normalized"`
+		DisplayNameNormalized string             `json:"display_name_normalized"`
+		Email                 string             `json:"email"`
+		ImageOriginal         string             `json:"image_original"`
+		Image24               string             `json:"image_24"`
+		Image32               string             `json:"image_32"`
+		Image48               string             `json:"image_48"`
+		Image72               string             `json:"image_72"`
+		Image192              string             `json:"image_192"`
+		Image512              string             `json:"image_512"`
+		Team                  string             `json:"team"`
+		Fields                SlackProfileFields `json:"fields"`
 	} `json:"profile"`
 	IsAdmin           bool `json:"is_admin"`
 	IsOwner           bool `json:"is_owner"`
@@ -0,0 +1,52 @@
+package slack
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+// applyUpdate merges an update request into stored attributes the way the data api does for a PUT
+func applyUpdate(t *testing.T, stored map[string]interface{}, update interface{}) map[string]interface{} {
+	t.Helper()
+	b, err := json.Marshal(update)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var changed map[string]interface{}
+	if err := json.Unmarshal(b, &changed); err != nil {
+		t.Fatal(err)
+	}
+	merged := map[string]interface{}{}
+	for k, v := range stored {
+		merged[k] = v
+	}
+	for k, v := range changed {
+		merged[k] = v
+	}
+	return merged
+}
+
+func TestSlackSyncKeepsUnrelatedFields(t *testing.T) {
+	stored := map[string]interface{}{
+		"display_name":   "old-name",
+		"email":          "old@example.com",
+		"slack_id":       "UC81JHDJ6",
+		"bio":            "Gopher and meetup regular",
+		"github_user":    "clint",
+		"twitter_handle": "clint_tweets",
+		"meetup_id":      "123456",
+	}
+	user := SlackUser{ID: "UC81JHDJ6", Name: "clint"}
+	user.Profile.Email = "clint@example.com"
+
+	got := applyUpdate(t, stored, personUpdateFromSlack(user))
+
+	for _, field := range []string{"bio", "github_user", "twitter_handle", "meetup_id"} {
+		if got[field] != stored[field] {
+			t.Errorf("sync changed %s from %v to %v", field, stored[field], got[field])
+		}
+	}
+	if got["display_name"] != "clint" || got["email"] != "clint@example.com" {
+		t.Errorf("sync = %v, expected display_name and email from slack", got)
+	}
+}
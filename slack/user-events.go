@@ -0,0 +1,65 @@
+package slack
+
+import (
+	"context"
+	"encoding/json"
+
+	"encore.dev/beta/errs"
+	"encore.dev/rlog"
+	"github.com/tidwall/gjson"
+)
+
+// HandleUserEvent keeps the person in step with a team_join or user_change event. Slack redelivers
+// events it thinks we missed, so a person that already matches the member is left alone.
+func HandleUserEvent(ctx context.Context, payload string) error {
+	eventUser, err := slackUserFromEvent(payload)
+	if err != nil {
+		rlog.Error("Error decoding user from slack event", "err", err)
+		return err
+	}
+
+	// The event only says who changed, the member is read back from slack so the change can't be made up
+	u, err := GetSlackUserByID(ctx, eventUser.ID)
+	if err != nil {
+		return err
+	}
+	if !isHumanMember(u) {
+		return nil
+	}
+	if len(loadProfileFieldMapping().Fields) > 0 {
+		u.Profile.Fields, err = loadSlackProfileFields(ctx, u.ID)
+		if err != nil {
+			rlog.Error("Error loading slack profile fields for slack event", "slackID", u.ID, "err", err)
+			return err
+		}
+	}
+
+	existing, err := loadPersonBySlackID(ctx, u.ID)
+	if err != nil {
+		if e, ok := err.(*errs.Error); !ok || e.Code != errs.NotFound {
+			rlog.Error("Error loading person for slack event", "slackID", u.ID, "err", err)
+			return err
+		}
+		existing = nil
+	}
+
+	update := slackUserChange(existing, u)
+	if update == nil {
+		rlog.Debug("Person already up to date with slack event", "slackID", u.ID)
+		return nil
+	}
+
+	_, err = upsertPersonBySlackID(ctx, u.ID, update)
+	if err != nil {
+		rlog.Error("Error saving person from slack event", "slackID", u.ID, "err", err)
+		return err
+	}
+	return nil
+}
+
+// slackUserFromEvent decodes the full user object team_join and user_change events carry
+func slackUserFromEvent(payload string) (SlackUser, error) {
+	var u SlackUser
+	err := json.Unmarshal([]byte(gjson.Get(payload, "event.user").Raw), &u)
+	return u, err
+}
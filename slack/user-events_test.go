@@ -0,0 +1,102 @@
+package slack
+
+import (
+	"os"
+	"testing"
+
+	"encore.app/data"
+)
+
+func loadEventUser(t *testing.T, name string) SlackUser {
+	t.Helper()
+	payload, err := os.ReadFile("example-payloads/" + name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := slackUserFromEvent(string(payload))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u
+}
+
+// personFromUpdate is the person the data api would hold after applying the update to existing
+func personFromUpdate(existing *data.Person, u *data.PersonUpdate) *data.Person {
+	p := &data.Person{}
+	if existing != nil {
+		*p = *existing
+	}
+	if u.SlackID != nil {
+		p.Attributes.SlackID = *u.SlackID
+	}
+	if u.DisplayName != nil {
+		p.Attributes.DisplayName = *u.DisplayName
+	}
+	if u.Email != nil {
+		p.Attributes.Email = *u.Email
+	}
+	if u.Inactive != nil {
+		p.Attributes.Inactive = *u.Inactive
+	}
+	return p
+}
+
+func TestTeamJoinCreatesPerson(t *testing.T) {
+	u := loadEventUser(t, "team-join-event.json")
+
+	update := slackUserChange(nil, u)
+	if update == nil {
+		t.Fatal("team_join for an unknown member made no change, expected a new person")
+	}
+	p := personFromUpdate(nil, update)
+	if p.Attributes.SlackID != "U05B2NEWBIE" || p.Attributes.DisplayName != "newbie" || p.Attributes.Email != "newbie@example.com" || p.Attributes.Inactive {
+		t.Errorf("team_join created %+v", p.Attributes)
+	}
+
+	if again := slackUserChange(p, u); again != nil {
+		t.Errorf("redelivered team_join = %+v, expected no change", again)
+	}
+}
+
+func TestUserChangeUpdatesPerson(t *testing.T) {
+	u := loadEventUser(t, "user-change-event.json")
+	existing := &data.Person{ID: 7}
+	existing.Attributes.SlackID = "UC81JHDJ6"
+	existing.Attributes.DisplayName = "clint"
+	existing.Attributes.Email = "clint@example.com"
+	existing.Attributes.Bio = "Gopher"
+
+	update := slackUserChange(existing, u)
+	if update == nil {
+		t.Fatal("user_change with a new email made no change")
+	}
+	p := personFromUpdate(existing, update)
+	if p.Attributes.Email != "clint@newdomain.example.com" || p.Attributes.Bio != "Gopher" {
+		t.Errorf("user_change updated person to %+v", p.Attributes)
+	}
+
+	if again := slackUserChange(p, u); again != nil {
+		t.Errorf("redelivered user_change = %+v, expected no change", again)
+	}
+}
+
+func TestUserChangeDeactivationMarksInactive(t *testing.T) {
+	u := loadEventUser(t, "user-change-deactivated-event.json")
+	existing := &data.Person{ID: 7}
+	existing.Attributes.SlackID = "UC81JHDJ6"
+	existing.Attributes.DisplayName = "clint"
+	existing.Attributes.Email = "clint@newdomain.example.com"
+
+	update := slackUserChange(existing, u)
+	if update == nil || update.Inactive == nil || !*update.Inactive {
+		t.Fatalf("deactivation = %+v, expected the person to be marked inactive", update)
+	}
+	p := personFromUpdate(existing, update)
+	if again := slackUserChange(p, u); again != nil {
+		t.Errorf("redelivered deactivation = %+v, expected no change", again)
+	}
+
+	if update := slackUserChange(nil, u); update != nil {
+		t.Errorf("deactivation of an unknown member = %+v, expected no person to be created", update)
+	}
+}
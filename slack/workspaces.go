@@ -0,0 +1,157 @@
+package slack
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+
+	"encore.app/data"
+	"encore.dev/rlog"
+)
+
+// Workspace is a slack workspace the forge app is installed in. Workspaces are configured with the
+// SlackWorkspaces secret, a JSON list like
+//
+//	[{"team_id": "T0FORGE", "name": "Forge Utah", "kolla_consumer": "internal"},
+//	 {"team_id": "T0OTHER", "name": "Other", "kolla_consumer": "T0OTHER", "tenant": "other", "organizer_group": "S0ORGS"}]
+//
+// Without the secret the app serves a single workspace the way it did before workspaces were configurable.
+type Workspace struct {
+	TeamID string `json:"team_id"`
+	Name   string `json:"name"`
+	// KollaConsumer is the internal-slack kolla consumer holding the workspace's bot token
+	KollaConsumer string `json:"kolla_consumer"`
+	// Tenant scopes the workspace's people in the Forge Data API, empty for the original forge workspace
+	Tenant string `json:"tenant"`
+	// OrganizerGroup is the slack user group whose members may run organizer commands
+	OrganizerGroup string `json:"organizer_group"`
+	// Channels replaces the onboarding content's recommended channels for this workspace
+	Channels []data.OnboardingChannel `json:"channels"`
+}
+
+// defaultWorkspace is used when SlackWorkspaces isn't set
+var defaultWorkspace = &Workspace{Name: "Forge Utah", KollaConsumer: internalSlackConsumer}
+
+// loadWorkspaces parses the workspaces secret, an unset or broken secret configures no workspaces
+func loadWorkspaces() []*Workspace {
+	if secrets.SlackWorkspaces == "" {
+		return nil
+	}
+	workspaces := []*Workspace{}
+	err := json.Unmarshal([]byte(secrets.SlackWorkspaces), &workspaces)
+	if err != nil {
+		rlog.Error("Error parsing SlackWorkspaces secret", "err", err)
+		return nil
+	}
+	return workspaces
+}
+
+// allWorkspaces is every workspace scheduled jobs have to run for
+func allWorkspaces() []*Workspace {
+	workspaces := loadWorkspaces()
+	if len(workspaces) == 0 {
+		return []*Workspace{defaultWorkspace}
+	}
+	return workspaces
+}
+
+// workspaceByTeam finds the workspace a slack payload came from. With no workspaces configured every team
+// is the default workspace.
+func workspaceByTeam(teamID string) (*Workspace, bool) {
+	workspaces := loadWorkspaces()
+	if len(workspaces) == 0 {
+		return defaultWorkspace, true
+	}
+	for _, ws := range workspaces {
+		if ws.TeamID == teamID {
+			return ws, true
+		}
+	}
+	return nil, false
+}
+
+// originalWorkspace is the workspace whose people have no tenant, the one forge started out with
+func originalWorkspace() *Workspace {
+	for _, ws := range loadWorkspaces() {
+		if ws.Tenant == "" {
+			return ws
+		}
+	}
+	return defaultWorkspace
+}
+
+type workspaceKey struct{}
+
+// withWorkspace makes the slack and data calls made with ctx act on ws
+func withWorkspace(ctx context.Context, ws *Workspace) context.Context {
+	return context.WithValue(ctx, workspaceKey{}, ws)
+}
+
+// workspaceFrom returns the workspace ctx acts on, the original workspace if none was set
+func workspaceFrom(ctx context.Context) *Workspace {
+	if ws, ok := ctx.Value(workspaceKey{}).(*Workspace); ok {
+		return ws
+	}
+	return originalWorkspace()
+}
+
+// memberConsumerID is the kolla consumer id for a member's linked accounts. Members of the original workspace
+// keep their plain slack id so the links they made before workspaces existed still work.
+func memberConsumerID(ws *Workspace, slackID string) string {
+	if ws.Tenant == "" {
+		return slackID
+	}
+	return ws.TeamID + ":" + slackID
+}
+
+// workspaceMember reverses memberConsumerID
+func workspaceMember(consumerID string) (*Workspace, string, bool) {
+	teamID, slackID, ok := strings.Cut(consumerID, ":")
+	if !ok {
+		return originalWorkspace(), consumerID, true
+	}
+	ws, ok := workspaceByTeam(teamID)
+	return ws, slackID, ok
+}
+
+// loadPersonBySlackID loads the person for a member of the workspace ctx acts on
+func loadPersonBySlackID(ctx context.Context, slackID string) (*data.Person, error) {
+	return data.LoadPersonBySlackID(ctx, slackID, &data.PersonLookupParams{Tenant: workspaceFrom(ctx).Tenant})
+}
+
+// upsertPersonBySlackID saves the update on the person for a member of the workspace ctx acts on
+func upsertPersonBySlackID(ctx context.Context, slackID string, update *data.PersonUpdate) (*data.Person, error) {
+	if tenant := workspaceFrom(ctx).Tenant; tenant != "" {
+		update.Tenant = &tenant
+	}
+	return data.UpsertPersonBySlackID(ctx, slackID, update)
+}
+
+// isWorkspaceOrganizer reports whether the member is in the workspace's organizer user group
+func isWorkspaceOrganizer(ctx context.Context, slackID string) (bool, error) {
+	ws := workspaceFrom(ctx)
+	if ws.OrganizerGroup == "" {
+		return false, nil
+	}
+	members, err := slackClient.UsergroupsUsersList(ctx, ws.OrganizerGroup)
+	if err != nil {
+		return false, err
+	}
+	for _, id := range members {
+		if id == slackID {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// workspaceOnboardingContent applies the workspace's channel recommendations to the onboarding content
+func workspaceOnboardingContent(ctx context.Context, content *data.OnboardingContent) *data.OnboardingContent {
+	ws := workspaceFrom(ctx)
+	if len(ws.Channels) == 0 {
+		return content
+	}
+	scoped := *content
+	scoped.Channels = ws.Channels
+	return &scoped
+}
@@ -0,0 +1,127 @@
+package slack
+
+import (
+	"context"
+	"testing"
+
+	"encore.app/data"
+)
+
+// useTwoWorkspaces configures the original forge workspace and a second one with its own tenant
+func useTwoWorkspaces(t *testing.T) (forge *Workspace, other *Workspace) {
+	old := secrets.SlackWorkspaces
+	secrets.SlackWorkspaces = `[
+		{"team_id": "T0FORGE", "name": "Forge Utah", "kolla_consumer": "internal"},
+		{"team_id": "T0OTHER", "name": "Other", "kolla_consumer": "T0OTHER", "tenant": "other", "organizer_group": "S0ORGS",
+		 "channels": [{"channel_id": "C0WELCOME", "description": "say hi"}]}
+	]`
+	t.Cleanup(func() { secrets.SlackWorkspaces = old })
+
+	forge, ok := workspaceByTeam("T0FORGE")
+	if !ok {
+		t.Fatal("forge workspace not configured")
+	}
+	other, ok = workspaceByTeam("T0OTHER")
+	if !ok {
+		t.Fatal("other workspace not configured")
+	}
+	return forge, other
+}
+
+// useCredentials makes slackToken and linked account lookups use p
+func useCredentials(t *testing.T, p CredentialProvider) {
+	credentialsOnce.Do(func() {})
+	old := credentials
+	credentials = p
+	t.Cleanup(func() { credentials = old })
+}
+
+func TestWorkspaceByTeam(t *testing.T) {
+	forge, other := useTwoWorkspaces(t)
+
+	if forge.Tenant != "" || other.Tenant != "other" {
+		t.Errorf("unexpected tenants %q and %q", forge.Tenant, other.Tenant)
+	}
+	if _, ok := workspaceByTeam("T0UNKNOWN"); ok {
+		t.Error("expected an unconfigured team to be rejected")
+	}
+	if ws := workspaceFrom(context.Background()); ws.TeamID != "T0FORGE" {
+		t.Errorf("expected calls without a workspace to act on the original workspace, got %s", ws.TeamID)
+	}
+	if len(allWorkspaces()) != 2 {
+		t.Errorf("expected scheduled jobs to run for both workspaces, got %d", len(allWorkspaces()))
+	}
+
+	// Without the secret every team is the single default workspace
+	secrets.SlackWorkspaces = ""
+	if ws, ok := workspaceByTeam("T0ANYTHING"); !ok || ws != defaultWorkspace {
+		t.Errorf("expected the default workspace, got %+v", ws)
+	}
+}
+
+func TestMemberConsumerIDs(t *testing.T) {
+	forge, other := useTwoWorkspaces(t)
+
+	if id := memberConsumerID(forge, "UC81JHDJ6"); id != "UC81JHDJ6" {
+		t.Errorf("original workspace members should keep their slack id as consumer id, got %q", id)
+	}
+	for _, ws := range []*Workspace{forge, other} {
+		got, slackID, ok := workspaceMember(memberConsumerID(ws, "UC81JHDJ6"))
+		if !ok || got.TeamID != ws.TeamID || slackID != "UC81JHDJ6" {
+			t.Errorf("consumer id for %s came back as %+v %q %v", ws.TeamID, got, slackID, ok)
+		}
+	}
+	if _, _, ok := workspaceMember("T0UNKNOWN:UC81JHDJ6"); ok {
+		t.Error("expected a consumer id from an unconfigured team to be rejected")
+	}
+}
+
+func TestSlackTokenPerWorkspace(t *testing.T) {
+	forge, other := useTwoWorkspaces(t)
+	useCredentials(t, newCachingCredentialProvider((&fakeCredentials{}).fetch))
+
+	forgeToken, err := slackToken(withWorkspace(context.Background(), forge))
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherToken, err := slackToken(withWorkspace(context.Background(), other))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if forgeToken != "internal-slack-internal-1" || otherToken != "internal-slack-T0OTHER-2" {
+		t.Errorf("expected each workspace's own bot token, got %q and %q", forgeToken, otherToken)
+	}
+}
+
+func TestWorkspaceOrganizersAndChannels(t *testing.T) {
+	forge, other := useTwoWorkspaces(t)
+	f := newFakeSlack(t)
+	f.usergroups["S0ORGS"] = []string{"UORGANIZER"}
+
+	for _, tc := range []struct {
+		ws      *Workspace
+		slackID string
+		want    bool
+	}{
+		{other, "UORGANIZER", true},
+		{other, "UMEMBER", false},
+		// The forge workspace has no organizer group configured
+		{forge, "UORGANIZER", false},
+	} {
+		got, err := isWorkspaceOrganizer(withWorkspace(context.Background(), tc.ws), tc.slackID)
+		if err != nil || got != tc.want {
+			t.Errorf("%s organizer %s = %v %v, expected %v", tc.ws.TeamID, tc.slackID, got, err, tc.want)
+		}
+	}
+
+	content := &data.OnboardingContent{Channels: []data.OnboardingChannel{{ChannelID: "C0GENERAL"}}}
+	if got := workspaceOnboardingContent(withWorkspace(context.Background(), forge), content); got.Channels[0].ChannelID != "C0GENERAL" {
+		t.Errorf("forge workspace should use the content's channels, got %+v", got.Channels)
+	}
+	if got := workspaceOnboardingContent(withWorkspace(context.Background(), other), content); got.Channels[0].ChannelID != "C0WELCOME" {
+		t.Errorf("other workspace should use its own channels, got %+v", got.Channels)
+	}
+	if content.Channels[0].ChannelID != "C0GENERAL" {
+		t.Error("workspace channels overwrote the shared onboarding content")
+	}
+}